@@ -0,0 +1,146 @@
+package vaulthunter
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	vapi "github.com/hashicorp/vault/api"
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	appsv1client "k8s.io/client-go/kubernetes/typed/apps/v1"
+)
+
+// pod template annotation holding a digest of the resolved secrets, for teams using helm style checksums
+const checksumAnnotation = "checksum/vault-hunter"
+
+// content hash of every secret create would write to namespace, keyed by secret name
+// -app limits the apps, and apps whose targets write elsewhere are skipped. values split into a configmap are included
+func secretHashes(c AppConfig, vclient *vapi.Client, namespace string) (map[string]string, error) {
+	apps, err := selectedApps(c)
+	if err != nil {
+		return nil, err
+	}
+	tconfig, err := parseTargets(c.vhFolder)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make(map[string]string)
+	for _, x := range apps {
+		appFolder := c.vhFolder + "/" + x
+		data := mergeConfig(appFolder, c.configEnv)
+		if !targetsWriteTo(c, appTargets(c, x, data, tconfig), namespace) {
+			debugLog(fmt.Sprintf("DEBUG: %s has no target writing to namespace %s, skipping", x, namespace), false)
+			continue
+		}
+		resolved, err := resolveSecrets(vclient, data)
+		if err != nil {
+			return nil, fmt.Errorf("error getting secrets: %s", err)
+		}
+		resolved, err = addTemplateSecrets(appFolder, data, resolved)
+		if err != nil {
+			return nil, fmt.Errorf("error rendering templates: %s", err)
+		}
+		for _, s := range resolved {
+			hashes[k8sSecretName(c, s.Name)] = secretContentHash(k8sSecretType(s.Type), k8sSecretData(s.Values))
+		}
+	}
+	return hashes, nil
+}
+
+// true if any target writes to namespace in the -kube-context being annotated, unset fields match anything
+func targetsWriteTo(c AppConfig, targets Targets, namespace string) bool {
+	for _, x := range targets {
+		if x.Namespace != "" && x.Namespace != namespace {
+			continue
+		}
+		if x.KubeContext != "" && c.kubeContext != "" && x.KubeContext != c.kubeContext {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// digest of the secrets in hashes the pod spec uses, false when it uses none of them
+// only changes when the resolved values of those secrets change
+func podSpecDigest(spec apiv1.PodSpec, hashes map[string]string) (string, bool) {
+	var lines []string
+	for name, hash := range hashes {
+		if podSpecUsesSecret(spec, name) {
+			lines = append(lines, name+" "+hash)
+		}
+	}
+	if len(lines) == 0 {
+		return "", false
+	}
+	sort.Strings(lines)
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:]), true
+}
+
+// sets the checksum annotation on each workload's pod template, ex. deploy/app-one
+// each workload's digest covers only the secrets it uses, so it only rolls when those change
+func annotateWorkloads(apps appsv1client.AppsV1Interface, namespace string, workloads []string, hashes map[string]string) error {
+	for _, x := range workloads {
+		x = strings.TrimSpace(x)
+		if x == "" {
+			continue
+		}
+		spec, err := workloadPodSpec(apps, namespace, x)
+		if err != nil {
+			return err
+		}
+		digest, ok := podSpecDigest(spec, hashes)
+		if !ok {
+			return fmt.Errorf("%s uses none of the secrets generated for namespace %s", x, namespace)
+		}
+		patch, err := podTemplateAnnotationPatch(map[string]string{checksumAnnotation: digest})
+		if err != nil {
+			return err
+		}
+		err = patchWorkload(apps, namespace, x, patch)
+		if err != nil {
+			return err
+		}
+		log.Printf("INFO: annotated %s with %s=%s", x, checksumAnnotation, digest)
+	}
+	return nil
+}
+
+// pod spec of a single workload given as kind/name
+func workloadPodSpec(apps appsv1client.AppsV1Interface, namespace string, ref string) (apiv1.PodSpec, error) {
+	ctx := context.TODO()
+	kind, name, err := parseWorkloadRef(ref)
+	if err != nil {
+		return apiv1.PodSpec{}, err
+	}
+	opts := metav1.GetOptions{}
+	var spec apiv1.PodSpec
+	switch kind {
+	case "deployment":
+		var x *appsv1.Deployment
+		if x, err = apps.Deployments(namespace).Get(ctx, name, opts); err == nil {
+			spec = x.Spec.Template.Spec
+		}
+	case "statefulset":
+		var x *appsv1.StatefulSet
+		if x, err = apps.StatefulSets(namespace).Get(ctx, name, opts); err == nil {
+			spec = x.Spec.Template.Spec
+		}
+	case "daemonset":
+		var x *appsv1.DaemonSet
+		if x, err = apps.DaemonSets(namespace).Get(ctx, name, opts); err == nil {
+			spec = x.Spec.Template.Spec
+		}
+	}
+	if err != nil {
+		return spec, fmt.Errorf("unable to get %s/%s: %s", kind, name, err)
+	}
+	return spec, nil
+}
@@ -0,0 +1,102 @@
+package vaulthunter
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_secretHashes(t *testing.T) {
+	tests := []struct {
+		name      string
+		c         AppConfig
+		namespace string
+		wantNames []string
+		wantErr   bool
+	}{
+		{name: "secretHashesTest", c: AppConfig{vhFolder: "./../../mocks/vh", configEnv: "dev", apps: []string{"targetapp"}}, namespace: "test", wantNames: []string{"targetapp"}},
+		{name: "secretHashesSuffixTest", c: AppConfig{vhFolder: "./../../mocks/vh", configEnv: "dev", apps: []string{"targetapp"}, secretNameSuffix: "issue-53"}, namespace: "test", wantNames: []string{"targetapp-issue-53"}},
+		{name: "secretHashesTargetsFileTest", c: AppConfig{vhFolder: "./../../mocks/vh", configEnv: "staging", apps: []string{"targetapp"}, kubeContext: "cluster-a"}, namespace: "api", wantNames: []string{"targetapp"}},
+		{name: "secretHashesTargetsFileOtherNamespaceTest", c: AppConfig{vhFolder: "./../../mocks/vh", configEnv: "staging", apps: []string{"targetapp"}, kubeContext: "cluster-a"}, namespace: "other", wantNames: nil},
+		{name: "secretHashesMapTargetsTest", c: AppConfig{vhFolder: "./../../mocks/vh", configEnv: "prod", apps: []string{"targetapp"}}, namespace: "targetapp", wantNames: []string{"targetapp"}},
+		{name: "secretHashesMapTargetsOtherNamespaceTest", c: AppConfig{vhFolder: "./../../mocks/vh", configEnv: "prod", apps: []string{"targetapp"}}, namespace: "default", wantNames: nil},
+		{name: "secretHashesAppTest", c: AppConfig{vhFolder: "./../../mocks/vh", configEnv: "dev", apps: []string{"targetapp", "rotateapp"}, app: "targetapp"}, namespace: "test", wantNames: []string{"targetapp"}},
+		{name: "secretHashesUnknownAppTest", c: AppConfig{vhFolder: "./../../mocks/vh", configEnv: "dev", apps: []string{"targetapp"}, app: "nope"}, namespace: "test", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := secretHashes(tt.c, nil, tt.namespace)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("secretHashes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var names []string
+			for x := range got {
+				names = append(names, x)
+			}
+			if !reflect.DeepEqual(names, tt.wantNames) {
+				t.Errorf("secretHashes() names = %v, want %v", names, tt.wantNames)
+			}
+		})
+	}
+}
+
+func Test_podSpecDigest(t *testing.T) {
+	spec := envFromTemplate("app-one").Spec
+	base, ok := podSpecDigest(spec, map[string]string{"app-one": "h1", "app-two": "h2"})
+	if !ok {
+		t.Fatalf("podSpecDigest() found no used secrets, want app-one")
+	}
+	if got, _ := podSpecDigest(spec, map[string]string{"app-one": "h1", "app-two": "changed"}); got != base {
+		t.Errorf("podSpecDigest() changed with a secret the pod doesn't use: %v, want %v", got, base)
+	}
+	if got, _ := podSpecDigest(spec, map[string]string{"app-one": "changed", "app-two": "h2"}); got == base {
+		t.Errorf("podSpecDigest() unchanged when a secret the pod uses changed")
+	}
+	if _, ok := podSpecDigest(spec, map[string]string{"app-two": "h2"}); ok {
+		t.Errorf("podSpecDigest() found used secrets, want none")
+	}
+}
+
+func Test_annotateWorkloads(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset(
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "app-one", Namespace: "test"}, Spec: appsv1.DeploymentSpec{Template: envFromTemplate("app-one")}},
+		&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "app-two", Namespace: "test"}, Spec: appsv1.StatefulSetSpec{Template: envFromTemplate("app-two")}},
+		&appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Name: "agent", Namespace: "test"}, Spec: appsv1.DaemonSetSpec{Template: envFromTemplate("unrelated")}},
+	)
+	hashes := map[string]string{"app-one": "h1", "app-two": "h2"}
+	tests := []struct {
+		name      string
+		workloads []string
+		wantErr   bool
+	}{
+		{name: "annotateWorkloadsTest", workloads: []string{"deploy/app-one", " sts/app-two"}},
+		{name: "annotateWorkloadsUnusedTest", workloads: []string{"ds/agent"}, wantErr: true},
+		{name: "annotateWorkloadsMissingTest", workloads: []string{"deploy/nope"}, wantErr: true},
+		{name: "annotateWorkloadsInvalidTest", workloads: []string{"pod/app-one"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := annotateWorkloads(kubeClient.AppsV1(), "test", tt.workloads, hashes)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("annotateWorkloads() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+	wantOne, _ := podSpecDigest(envFromTemplate("app-one").Spec, hashes)
+	wantTwo, _ := podSpecDigest(envFromTemplate("app-two").Spec, hashes)
+	deployment, _ := kubeClient.AppsV1().Deployments("test").Get(context.TODO(), "app-one", metav1.GetOptions{})
+	if got := deployment.Spec.Template.Annotations[checksumAnnotation]; got != wantOne {
+		t.Errorf("deployment annotation = %v, want %v", got, wantOne)
+	}
+	statefulSet, _ := kubeClient.AppsV1().StatefulSets("test").Get(context.TODO(), "app-two", metav1.GetOptions{})
+	if got := statefulSet.Spec.Template.Annotations[checksumAnnotation]; got != wantTwo {
+		t.Errorf("statefulset annotation = %v, want %v", got, wantTwo)
+	}
+	if wantOne == wantTwo {
+		t.Errorf("workloads using different secrets got the same digest %v", wantOne)
+	}
+}
@@ -0,0 +1,77 @@
+package vaulthunter
+
+import (
+	"fmt"
+	"strings"
+
+	vapi "github.com/hashicorp/vault/api"
+)
+
+// auth mount each role type is written to unless -jwt-mount/-kubernetes-mount are set
+var roleTypeMounts = map[string]string{
+	"jwt":        "jwt",
+	"kubernetes": "kubernetes",
+}
+
+// auth method types each role type can be written to, the jwt plugin serves both jwt and oidc mounts
+var roleTypeAuthTypes = map[string][]string{
+	"jwt":        {"jwt", "oidc"},
+	"kubernetes": {"kubernetes"},
+}
+
+// mount path without the auth/ prefix or slashes, ex. auth/gitlab/ -> gitlab
+func normalizeMount(mount string) string {
+	return strings.Trim(strings.TrimPrefix(strings.Trim(mount, "/"), "auth/"), "/")
+}
+
+// mount a unit's roles of a role type are written to - a map's jwt_mount, then -jwt-mount/-kubernetes-mount, then the default
+func roleMount(c AppConfig, u policyUnit, roleType string) string {
+	mount := ""
+	switch roleType {
+	case "jwt":
+		mount = c.jwtMount
+		if u.JWTMount != "" {
+			mount = u.JWTMount
+		}
+	case "kubernetes":
+		mount = c.kubernetesMount
+	}
+	if mount = normalizeMount(mount); mount == "" {
+		mount = roleTypeMounts[roleType]
+	}
+	return mount
+}
+
+// errors unless an auth method of the role type's type is mounted at mount
+func checkAuthMount(client *vapi.Client, mount string, roleType string) error {
+	auths, err := client.Sys().ListAuth()
+	if err != nil {
+		return fmt.Errorf("unable to list auth methods: %s", err)
+	}
+	a, ok := auths[mount+"/"]
+	if !ok {
+		return fmt.Errorf("no auth method mounted at auth/%s - pass -%s-mount with the mount %s roles belong to", mount, roleType, roleType)
+	}
+	if !containsString(roleTypeAuthTypes[roleType], a.Type) {
+		return fmt.Errorf("auth/%s is a %s auth method, %s roles need one of %s", mount, a.Type, roleType, strings.Join(roleTypeAuthTypes[roleType], ", "))
+	}
+	return nil
+}
+
+// checks every mount the units' roles are written to, once each
+func checkRoleMounts(c AppConfig, client *vapi.Client, units []policyUnit, roleTypes []string) error {
+	checked := make(map[string]bool)
+	for _, u := range units {
+		for _, t := range roleTypes {
+			mount := roleMount(c, u, t)
+			if checked[t+":"+mount] {
+				continue
+			}
+			checked[t+":"+mount] = true
+			if err := checkAuthMount(client, mount, t); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
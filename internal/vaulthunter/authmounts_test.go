@@ -0,0 +1,52 @@
+package vaulthunter
+
+import "testing"
+
+func Test_normalizeMount(t *testing.T) {
+	type args struct {
+		mount string
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{name: "normalizeMountTest", args: args{mount: "gitlab"}, want: "gitlab"},
+		{name: "normalizeMountPrefixTest", args: args{mount: "auth/gitlab/"}, want: "gitlab"},
+		{name: "normalizeMountNestedTest", args: args{mount: "/ci/gitlab/"}, want: "ci/gitlab"},
+		{name: "normalizeMountEmptyTest", args: args{mount: ""}, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeMount(tt.args.mount); got != tt.want {
+				t.Errorf("normalizeMount() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_roleMount(t *testing.T) {
+	type args struct {
+		c        AppConfig
+		u        policyUnit
+		roleType string
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{name: "roleMountDefaultTest", args: args{roleType: "jwt"}, want: "jwt"},
+		{name: "roleMountKubernetesDefaultTest", args: args{roleType: "kubernetes"}, want: "kubernetes"},
+		{name: "roleMountFlagTest", args: args{c: AppConfig{jwtMount: "auth/gitlab"}, roleType: "jwt"}, want: "gitlab"},
+		{name: "roleMountMapTest", args: args{c: AppConfig{jwtMount: "gitlab"}, u: policyUnit{JWTMount: "gitlab-ee"}, roleType: "jwt"}, want: "gitlab-ee"},
+		{name: "roleMountKubernetesFlagTest", args: args{c: AppConfig{jwtMount: "gitlab", kubernetesMount: "k8s-prod"}, u: policyUnit{JWTMount: "gitlab-ee"}, roleType: "kubernetes"}, want: "k8s-prod"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := roleMount(tt.args.c, tt.args.u, tt.args.roleType); got != tt.want {
+				t.Errorf("roleMount() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
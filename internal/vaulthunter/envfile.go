@@ -0,0 +1,197 @@
+package vaulthunter
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	vapi "github.com/hashicorp/vault/api"
+	"github.com/zclconf/go-cty/cty"
+	"gopkg.in/yaml.v2"
+)
+
+// file extension for each env file format
+var envFileFormats = map[string]string{
+	"shell":      ".env",
+	"dotenv":     ".env",
+	"docker":     ".env",
+	"json":       ".json",
+	"yaml":       ".yaml",
+	"properties": ".properties",
+	"tfvars":     ".tfvars",
+}
+
+// escapes for values within double quotes in a shell script
+var shellEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`")
+
+// escapes for values within double quotes in a dotenv file, newlines are written as \n
+var dotenvEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "\n", `\n`, "\r", `\r`)
+
+// env file path for an app, dir "-" writes to stdout
+func envFileName(dir string, app string, env string, format string) string {
+	if dir == "-" {
+		return "-"
+	}
+	return dir + "/" + app + "-" + env + envFileFormats[format]
+}
+
+// renders secrets in the given format, keys are sorted
+// removeExport only applies to the shell format
+func formatEnvFile(secrets map[string]interface{}, format string, removeExport bool) ([]byte, error) {
+	var keys []string
+	values := make(map[string]string)
+	for k, v := range secrets {
+		keys = append(keys, k)
+		values[k] = fmt.Sprintf("%v", v)
+	}
+	sort.Strings(keys)
+	// env vars are c strings, so the formats sourced or loaded into a process's env can't hold a NUL
+	if format == "" || format == "shell" || format == "dotenv" || format == "docker" {
+		for _, k := range keys {
+			if strings.ContainsRune(values[k], 0) {
+				return nil, fmt.Errorf("%s contains a NUL byte, which env vars can't hold - use another format", k)
+			}
+		}
+	}
+	var b strings.Builder
+	switch format {
+	case "", "shell":
+		for _, k := range keys {
+			if !removeExport {
+				b.WriteString("export ")
+			}
+			fmt.Fprintf(&b, "%s=\"%s\"\n", k, shellEscaper.Replace(values[k]))
+		}
+	case "dotenv":
+		for _, k := range keys {
+			fmt.Fprintf(&b, "%s=\"%s\"\n", k, dotenvEscaper.Replace(values[k]))
+		}
+	case "docker":
+		// docker env files have no quoting or escaping, values are used verbatim up to the end of the line
+		for _, k := range keys {
+			if strings.ContainsAny(values[k], "\r\n") {
+				return nil, fmt.Errorf("%s contains a newline, which docker env files can't represent - use another format", k)
+			}
+			fmt.Fprintf(&b, "%s=%s\n", k, values[k])
+		}
+	case "json":
+		j, err := json.MarshalIndent(values, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		b.Write(j)
+		b.WriteString("\n")
+	case "yaml":
+		y, err := yaml.Marshal(values)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(y)
+	case "properties":
+		for _, k := range keys {
+			fmt.Fprintf(&b, "%s=%s\n", escapeProperty(k, true), escapeProperty(values[k], false))
+		}
+	case "tfvars":
+		f := hclwrite.NewEmptyFile()
+		for _, k := range keys {
+			if !hclsyntax.ValidIdentifier(k) {
+				return nil, fmt.Errorf("%s is not a valid tfvars variable name", k)
+			}
+			f.Body().SetAttributeValue(k, cty.StringVal(values[k]))
+		}
+		b.Write(f.Bytes())
+	default:
+		return nil, fmt.Errorf("unknown env file format: %s - must be one of shell, dotenv, docker, json, yaml, properties or tfvars", format)
+	}
+	return []byte(b.String()), nil
+}
+
+// escapes a java properties key or value, non-ascii characters are written as \uXXXX
+func escapeProperty(s string, key bool) string {
+	var b strings.Builder
+	for i, r := range s {
+		switch {
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\f':
+			b.WriteString(`\f`)
+		case r == '=' || r == ':' || r == '#' || r == '!':
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		case r == ' ' && (key || i == 0):
+			b.WriteString(`\ `)
+		case r < 0x20 || r > 0x7e:
+			for _, u := range utf16.Encode([]rune{r}) {
+				fmt.Fprintf(&b, `\u%04x`, u)
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// writes each app's env file and rendered templates to -env-file-dir
+// templates are written below a folder named after the app, so apps with the same output don't overwrite each other
+func generateEnvFiles(c AppConfig, client *vapi.Client) error {
+	for _, x := range c.apps {
+		appFolder := c.vhFolder + "/" + x
+		data, err := loadConfig(appFolder, c.configEnv)
+		if err != nil {
+			return err
+		}
+		resolved, err := resolveSecrets(client, data)
+		if err != nil {
+			return err
+		}
+		secrets, err := combineSecrets(resolved)
+		if err != nil {
+			return err
+		}
+		filename := envFileName(c.envFileDirectory, x, c.configEnv, c.format)
+		err = writeEnvFile(secrets, filename, c.format, c.removeExport)
+		if err != nil {
+			return err
+		}
+		if len(data.Templates) > 0 && c.envFileDirectory == "-" {
+			log.Printf("WARN: skipping templates for %s, they can't be written to stdout", x)
+			continue
+		}
+		err = writeTemplateFiles(filepath.Join(c.envFileDirectory, x), appFolder, data.Templates, secrets)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writes secrets to filename in the given format, "-" writes to stdout
+func writeEnvFile(secrets map[string]interface{}, filename string, format string, removeExport bool) error {
+	contents, err := formatEnvFile(secrets, format, removeExport)
+	if err != nil {
+		return err
+	}
+	if filename == "-" {
+		_, err = os.Stdout.Write(contents)
+		return err
+	}
+	err = os.WriteFile(filename, contents, 0600)
+	if err != nil {
+		return err
+	}
+	log.Printf("created/updated env file: %s", filename)
+	return nil
+}
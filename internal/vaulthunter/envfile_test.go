@@ -0,0 +1,305 @@
+package vaulthunter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/joho/godotenv"
+	"github.com/magiconair/properties"
+	"gopkg.in/yaml.v2"
+)
+
+// values which break naive quoting
+var trickySecrets = map[string]interface{}{
+	"PEM":    "-----BEGIN KEY-----\nabc$HOME${HOME}%{x}`whoami`\"'\\\n-----END KEY-----\n",
+	"PLAIN":  "something",
+	"SPACES": "  lead = trail: #!",
+	"EMPTY":  "",
+	"UTF8":   "héllo ☃",
+	"QUOTES": `'single' "double" \"escaped\" 'unclosed`,
+	"EQUALS": "a=b==c=",
+	"HASH":   "#not a comment # nor=this",
+	"NUL":    "before\x00after",
+}
+
+// tricky values as strings, without the given keys
+func trickyValues(without ...string) map[string]string {
+	values := make(map[string]string)
+	for k, v := range trickySecrets {
+		values[k] = v.(string)
+	}
+	for _, k := range without {
+		delete(values, k)
+	}
+	return values
+}
+
+// tricky secrets without the given keys
+func trickySecretsWithout(without ...string) map[string]interface{} {
+	secrets := make(map[string]interface{})
+	for k, v := range trickyValues(without...) {
+		secrets[k] = v
+	}
+	return secrets
+}
+
+// parses an env file the way docker run --env-file does - one variable per line, no quoting, values used verbatim
+func parseDockerEnvFile(b []byte) (map[string]string, error) {
+	got := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := strings.TrimLeftFunc(scanner.Text(), unicode.IsSpace)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		data := strings.SplitN(line, "=", 2)
+		if strings.ContainsAny(data[0], " \t") || len(data) != 2 {
+			return nil, fmt.Errorf("invalid docker env file line %q", line)
+		}
+		got[data[0]] = data[1]
+	}
+	return got, scanner.Err()
+}
+
+func Test_formatEnvFileRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		// keys whose values the format can't represent, formatting them must fail
+		unsupported []string
+		parse       func(t *testing.T, b []byte) map[string]string
+	}{
+		{
+			name:   "formatEnvFileJSONTest",
+			format: "json",
+			parse: func(t *testing.T, b []byte) map[string]string {
+				var got map[string]string
+				if err := json.Unmarshal(b, &got); err != nil {
+					t.Fatalf("json.Unmarshal() error = %v", err)
+				}
+				return got
+			},
+		},
+		{
+			name:   "formatEnvFileYAMLTest",
+			format: "yaml",
+			parse: func(t *testing.T, b []byte) map[string]string {
+				var got map[string]string
+				if err := yaml.Unmarshal(b, &got); err != nil {
+					t.Fatalf("yaml.Unmarshal() error = %v", err)
+				}
+				return got
+			},
+		},
+		{
+			name:   "formatEnvFileTfvarsTest",
+			format: "tfvars",
+			parse: func(t *testing.T, b []byte) map[string]string {
+				f, diags := hclsyntax.ParseConfig(b, "test.tfvars", hcl.Pos{Line: 1, Column: 1})
+				if diags.HasErrors() {
+					t.Fatalf("hclsyntax.ParseConfig() error = %v", diags)
+				}
+				attrs, diags := f.Body.JustAttributes()
+				if diags.HasErrors() {
+					t.Fatalf("JustAttributes() error = %v", diags)
+				}
+				got := make(map[string]string)
+				for k, a := range attrs {
+					v, diags := a.Expr.Value(nil)
+					if diags.HasErrors() {
+						t.Fatalf("Value() error = %v", diags)
+					}
+					got[k] = v.AsString()
+				}
+				return got
+			},
+		},
+		{
+			name:        "formatEnvFileDotenvTest",
+			format:      "dotenv",
+			unsupported: []string{"NUL"},
+			parse: func(t *testing.T, b []byte) map[string]string {
+				got, err := godotenv.Unmarshal(string(b))
+				if err != nil {
+					t.Fatalf("godotenv.Unmarshal() error = %v", err)
+				}
+				return got
+			},
+		},
+		{
+			name:   "formatEnvFilePropertiesTest",
+			format: "properties",
+			parse: func(t *testing.T, b []byte) map[string]string {
+				l := &properties.Loader{Encoding: properties.UTF8, DisableExpansion: true}
+				p, err := l.LoadBytes(b)
+				if err != nil {
+					t.Fatalf("properties.LoadBytes() error = %v", err)
+				}
+				return p.Map()
+			},
+		},
+		{
+			name:        "formatEnvFileDockerTest",
+			format:      "docker",
+			unsupported: []string{"PEM", "NUL"},
+			parse: func(t *testing.T, b []byte) map[string]string {
+				got, err := parseDockerEnvFile(b)
+				if err != nil {
+					t.Fatalf("parseDockerEnvFile() error = %v", err)
+				}
+				if n := strings.Count(string(b), "\n"); n != len(got) {
+					t.Errorf("formatEnvFile() wrote %d lines for %d vars", n, len(got))
+				}
+				return got
+			},
+		},
+		{
+			name:        "formatEnvFileShellTest",
+			format:      "shell",
+			unsupported: []string{"NUL"},
+			parse: func(t *testing.T, b []byte) map[string]string {
+				sh, err := exec.LookPath("sh")
+				if err != nil {
+					t.Skip("sh not available")
+				}
+				file := filepath.Join(t.TempDir(), "test.env")
+				if err := ioutil.WriteFile(file, b, 0600); err != nil {
+					t.Fatal(err)
+				}
+				// print each value followed by a NUL so trailing newlines survive
+				var keys []string
+				for k := range trickyValues("NUL") {
+					keys = append(keys, k)
+				}
+				script := ". " + file
+				for _, k := range keys {
+					script += `; printf '%s\0' "$` + k + `"`
+				}
+				out, err := exec.Command(sh, "-c", script).Output()
+				if err != nil {
+					t.Fatalf("sh error = %v", err)
+				}
+				got := make(map[string]string)
+				for i, v := range strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00") {
+					got[keys[i]] = v
+				}
+				return got
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, k := range tt.unsupported {
+				if _, err := formatEnvFile(map[string]interface{}{k: trickySecrets[k]}, tt.format, false); err == nil {
+					t.Errorf("formatEnvFile() expected an error for %s", k)
+				}
+			}
+			b, err := formatEnvFile(trickySecretsWithout(tt.unsupported...), tt.format, false)
+			if err != nil {
+				t.Fatalf("formatEnvFile() error = %v", err)
+			}
+			want := trickyValues(tt.unsupported...)
+			if got := tt.parse(t, b); !reflect.DeepEqual(got, want) {
+				t.Errorf("formatEnvFile() round trip \ngot = \n%q, \nwant = \n%q", got, want)
+			}
+		})
+	}
+}
+
+func Test_formatEnvFile(t *testing.T) {
+	type args struct {
+		secrets      map[string]interface{}
+		format       string
+		removeExport bool
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "formatEnvFileShellTest",
+			args: args{secrets: map[string]interface{}{"A": "say \"hi\" to $USER `now`", "B": "x"}, format: "shell"},
+			want: "export A=\"say \\\"hi\\\" to \\$USER \\`now\\`\"\nexport B=\"x\"\n",
+		},
+		{
+			name: "formatEnvFileShellRemoveExportTest",
+			args: args{secrets: map[string]interface{}{"A": "x"}, format: "shell", removeExport: true},
+			want: "A=\"x\"\n",
+		},
+		{
+			name: "formatEnvFileDotenvTest",
+			args: args{secrets: map[string]interface{}{"A": "line1\nline2 \"q\" $X \\"}, format: "dotenv"},
+			want: "A=\"line1\\nline2 \\\"q\\\" \\$X \\\\\"\n",
+		},
+		{
+			name: "formatEnvFileDockerTest",
+			args: args{secrets: map[string]interface{}{"A": "has \"quotes\" and $X", "B": "x"}, format: "docker"},
+			want: "A=has \"quotes\" and $X\nB=x\n",
+		},
+		{
+			name:    "formatEnvFileDockerNewlineTest",
+			args:    args{secrets: map[string]interface{}{"A": "line1\nline2"}, format: "docker"},
+			wantErr: true,
+		},
+		{
+			name: "formatEnvFilePropertiesTest",
+			args: args{secrets: map[string]interface{}{"a key": " x=y:z #! \\\nhé"}, format: "properties"},
+			want: "a\\ key=\\ x\\=y\\:z \\#\\! \\\\\\nh\\u00e9\n",
+		},
+		{
+			name:    "formatEnvFileTfvarsInvalidNameTest",
+			args:    args{secrets: map[string]interface{}{".dockerconfigjson": "{}"}, format: "tfvars"},
+			wantErr: true,
+		},
+		{
+			name:    "formatEnvFileUnknownTest",
+			args:    args{secrets: map[string]interface{}{"A": "x"}, format: "toml"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := formatEnvFile(tt.args.secrets, tt.args.format, tt.args.removeExport)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("formatEnvFile() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !bytes.Equal(got, []byte(tt.want)) {
+				t.Errorf("formatEnvFile() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_envFileName(t *testing.T) {
+	tests := []struct {
+		name   string
+		dir    string
+		format string
+		want   string
+	}{
+		{name: "envFileNameTest", dir: ".", format: "shell", want: "./app-two-api-dev.env"},
+		{name: "envFileNameJSONTest", dir: "out", format: "json", want: "out/app-two-api-dev.json"},
+		{name: "envFileNameStdoutTest", dir: "-", format: "yaml", want: "-"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := envFileName(tt.dir, "app-two-api", "dev", tt.format); got != tt.want {
+				t.Errorf("envFileName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
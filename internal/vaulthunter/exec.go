@@ -0,0 +1,174 @@
+package vaulthunter
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"reflect"
+	"sort"
+	"syscall"
+	"time"
+
+	vapi "github.com/hashicorp/vault/api"
+)
+
+// signals passed on to the child command instead of stopping vault-hunter
+var forwardedSignals = []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT}
+
+// time a child has to exit after being asked to stop for a restart before it is killed
+var restartGracePeriod = 10 * time.Second
+
+// looks up the current secret values for the child's environment
+type secretLookup func() (map[string]interface{}, error)
+
+// looks up an app's secrets from its map, errors are returned rather than exiting so a watched child is never orphaned
+func appSecretLookup(client *vapi.Client, folder string, env string) secretLookup {
+	return func() (map[string]interface{}, error) {
+		_, secrets, err := getSecrets(client, folder, env)
+		return secrets, err
+	}
+}
+
+// picks the app to run a command for - -app, or the only app in the vh folder
+func execApp(c AppConfig) (string, error) {
+	if c.app != "" {
+		if !containsString(c.apps, c.app) {
+			return "", fmt.Errorf("app %s not found in %s", c.app, c.vhFolder)
+		}
+		return c.app, nil
+	}
+	if len(c.apps) == 1 {
+		return c.apps[0], nil
+	}
+	return "", fmt.Errorf("found %d apps in %s - pick one with -app", len(c.apps), c.vhFolder)
+}
+
+// environment for the child, the secrets are added to base and override any existing values
+func childEnv(base []string, secrets map[string]interface{}) []string {
+	env := make([]string, 0, len(base)+len(secrets))
+	for _, x := range base {
+		for i := 0; i < len(x); i++ {
+			if x[i] == '=' {
+				if _, ok := secrets[x[:i]]; !ok {
+					env = append(env, x)
+				}
+				break
+			}
+		}
+	}
+	keys := make([]string, 0, len(secrets))
+	for k := range secrets {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		env = append(env, fmt.Sprintf("%s=%v", k, secrets[k]))
+	}
+	return env
+}
+
+// runs args with the secrets in its environment, forwarding signals and returning the command's exit code
+// with watch set, secrets are looked up again on that interval and the command is restarted when they change
+// secrets are only ever passed through the environment, nothing is written to disk
+func runWithSecrets(args []string, lookup secretLookup, watch time.Duration) (int, error) {
+	secrets, err := lookup()
+	if err != nil {
+		return 1, err
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, forwardedSignals...)
+	defer signal.Stop(sigs)
+	for {
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		cmd.Env = childEnv(os.Environ(), secrets)
+		if err := cmd.Start(); err != nil {
+			return 1, fmt.Errorf("unable to start %s: %s", args[0], err)
+		}
+		done := make(chan error, 1)
+		go func() {
+			done <- cmd.Wait()
+		}()
+		stopWatch := make(chan struct{})
+		var changes <-chan map[string]interface{}
+		if watch > 0 {
+			changes = watchSecrets(lookup, secrets, watch, stopWatch)
+		}
+		restart, err := waitForChild(cmd, done, sigs, changes, &secrets)
+		close(stopWatch)
+		if !restart {
+			return exitCode(err), nil
+		}
+		log.Printf("INFO: secrets changed, restarted %s", args[0])
+	}
+}
+
+// waits for the child to exit, returns true when it was stopped because secrets changed
+func waitForChild(cmd *exec.Cmd, done <-chan error, sigs <-chan os.Signal, changes <-chan map[string]interface{}, secrets *map[string]interface{}) (bool, error) {
+	restart := false
+	var kill <-chan time.Time
+	for {
+		select {
+		case sig := <-sigs:
+			debugLog(fmt.Sprintf("DEBUG: forwarding %s to child", sig), false)
+			cmd.Process.Signal(sig)
+		case s := <-changes:
+			*secrets = s
+			restart = true
+			if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+				cmd.Process.Kill()
+			}
+			kill = time.After(restartGracePeriod)
+		case <-kill:
+			cmd.Process.Kill()
+		case err := <-done:
+			return restart, err
+		}
+	}
+}
+
+// looks up secrets every interval until they differ from current, which is sent on the returned channel
+func watchSecrets(lookup secretLookup, current map[string]interface{}, interval time.Duration, stop <-chan struct{}) <-chan map[string]interface{} {
+	changes := make(chan map[string]interface{}, 1)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				secrets, err := lookup()
+				if err != nil {
+					log.Printf("WARN: unable to look up secrets, keeping the command running with the current values: %s", err)
+					continue
+				}
+				if !reflect.DeepEqual(secrets, current) {
+					changes <- secrets
+					return
+				}
+			}
+		}
+	}()
+	return changes
+}
+
+// exit code of a finished command, commands stopped by a signal exit with 128 + the signal number like a shell
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return 1
+	}
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return exitErr.ExitCode()
+}
@@ -0,0 +1,237 @@
+package vaulthunter
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_execApp(t *testing.T) {
+	type args struct {
+		c AppConfig
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "execAppFlagTest",
+			args: args{c: AppConfig{app: "app-two", apps: []string{"app-one", "app-two"}}},
+			want: "app-two",
+		},
+		{
+			name: "execAppOnlyAppTest",
+			args: args{c: AppConfig{apps: []string{"app-one"}}},
+			want: "app-one",
+		},
+		{
+			name:    "execAppAmbiguousTest",
+			args:    args{c: AppConfig{apps: []string{"app-one", "app-two"}}},
+			wantErr: true,
+		},
+		{
+			name:    "execAppUnknownTest",
+			args:    args{c: AppConfig{app: "app-nine", apps: []string{"app-one"}}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := execApp(tt.args.c)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("execApp() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("execApp() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_childEnv(t *testing.T) {
+	type args struct {
+		base    []string
+		secrets map[string]interface{}
+	}
+	tests := []struct {
+		name string
+		args args
+		want []string
+	}{
+		{
+			name: "childEnvOverrideTest",
+			args: args{
+				base:    []string{"PATH=/bin", "API_KEY=old", "EMPTY="},
+				secrets: map[string]interface{}{"API_KEY": "new", "DB_PASS": "p=ss\nword", "PORT": 8080},
+			},
+			want: []string{"PATH=/bin", "EMPTY=", "API_KEY=new", "DB_PASS=p=ss\nword", "PORT=8080"},
+		},
+		{
+			name: "childEnvNoSecretsTest",
+			args: args{base: []string{"PATH=/bin"}},
+			want: []string{"PATH=/bin"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := childEnv(tt.args.base, tt.args.secrets); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("childEnv() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// returns the same secrets on every lookup
+func staticLookup(secrets map[string]interface{}) secretLookup {
+	return func() (map[string]interface{}, error) {
+		return secrets, nil
+	}
+}
+
+// returns each set of secrets in turn, repeating the last one
+func sequenceLookup(secrets ...map[string]interface{}) secretLookup {
+	var mu sync.Mutex
+	i := 0
+	return func() (map[string]interface{}, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		s := secrets[i]
+		if i < len(secrets)-1 {
+			i++
+		}
+		return s, nil
+	}
+}
+
+// returns secrets on the first lookup and an error on every one after
+func failingLookup(secrets map[string]interface{}) secretLookup {
+	var mu sync.Mutex
+	called := false
+	return func() (map[string]interface{}, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if called {
+			return nil, errors.New("vault unavailable")
+		}
+		called = true
+		return secrets, nil
+	}
+}
+
+func Test_appSecretLookup(t *testing.T) {
+	folder := t.TempDir()
+	b, err := ioutil.ReadFile("./../../mocks/vh/targetapp/dev.yaml")
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(folder, "dev.yaml"), b, 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	lookup := appSecretLookup(nil, folder, "dev")
+	got, err := lookup()
+	if err != nil {
+		t.Fatalf("appSecretLookup() error = %v", err)
+	}
+	if want := map[string]interface{}{"APP_ENV": "dev"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("appSecretLookup() = %v, want %v", got, want)
+	}
+	// the map disappearing while watching is an error, not an exit
+	if err := os.Remove(filepath.Join(folder, "dev.yaml")); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if _, err := lookup(); err == nil {
+		t.Errorf("appSecretLookup() error = nil, want an error for a missing map")
+	}
+}
+
+func Test_runWithSecrets(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+	out := filepath.Join(t.TempDir(), "out")
+	type args struct {
+		script string
+		lookup secretLookup
+		watch  time.Duration
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    int
+		wantOut string
+	}{
+		{
+			name: "runWithSecretsEnvTest",
+			args: args{
+				script: `[ "$DB_PASS" = 'p"ss $x' ] && exit 0; exit 1`,
+				lookup: staticLookup(map[string]interface{}{"DB_PASS": `p"ss $x`}),
+			},
+			want: 0,
+		},
+		{
+			name: "runWithSecretsExitCodeTest",
+			args: args{
+				script: "exit 3",
+				lookup: staticLookup(nil),
+			},
+			want: 3,
+		},
+		{
+			name: "runWithSecretsSignaledTest",
+			args: args{
+				script: "kill -TERM $$",
+				lookup: staticLookup(nil),
+			},
+			want: 143,
+		},
+		{
+			name: "runWithSecretsWatchTest",
+			args: args{
+				script: `echo "$VERSION" >> ` + out + `; [ "$VERSION" = 2 ] && exit 0; exec sleep 10`,
+				lookup: sequenceLookup(map[string]interface{}{"VERSION": "1"}, map[string]interface{}{"VERSION": "2"}),
+				watch:  50 * time.Millisecond,
+			},
+			want:    0,
+			wantOut: "1\n2\n",
+		},
+		{
+			name: "runWithSecretsWatchLookupErrorTest",
+			args: args{
+				script: `[ "$VERSION" = 1 ] && sleep 0.3 && exit 0; exit 1`,
+				lookup: failingLookup(map[string]interface{}{"VERSION": "1"}),
+				watch:  50 * time.Millisecond,
+			},
+			want: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := runWithSecrets([]string{"sh", "-c", tt.args.script}, tt.args.lookup, tt.args.watch)
+			if err != nil {
+				t.Errorf("runWithSecrets() error = %v", err)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("runWithSecrets() = %v, want %v", got, tt.want)
+			}
+			if tt.wantOut != "" {
+				b, err := ioutil.ReadFile(out)
+				if err != nil {
+					t.Fatalf("ReadFile() error = %v", err)
+				}
+				if string(b) != tt.wantOut {
+					t.Errorf("runWithSecrets() wrote %q, want %q", b, tt.wantOut)
+				}
+			}
+		})
+	}
+}
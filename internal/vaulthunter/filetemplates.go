@@ -0,0 +1,156 @@
+package vaulthunter
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"text/template"
+)
+
+// valid k8s secret keys, rendered templates are stored under their output name
+var secretKeyRe = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+
+// a file rendered from the map's resolved secrets, ex. a database.php or application.yml
+// source is a go text/template, relative to the app's folder, rendered with the combined secret values as its data
+// output is the rendered file's name - written to -env-file-dir by generate-env-file and used as the key in the secret by create
+// secret picks which secret create stores the file in, defaults to the map's secret_name
+type TemplateDef struct {
+	Source string `yaml:"source"`
+	Output string `yaml:"output"`
+	Secret string `yaml:"secret,omitempty"`
+}
+
+type Templates []TemplateDef
+
+// a rendered template
+type renderedTemplate struct {
+	TemplateDef
+	Contents []byte
+}
+
+// merges base and env templates, an env template replaces a base template with the same output
+func mergeTemplates(base Templates, env Templates) Templates {
+	if len(base) == 0 && len(env) == 0 {
+		return nil
+	}
+	merged := append(Templates{}, base...)
+	for _, x := range env {
+		replaced := false
+		for i := range merged {
+			if merged[i].Output == x.Output {
+				merged[i] = x
+				replaced = true
+			}
+		}
+		if !replaced {
+			merged = append(merged, x)
+		}
+	}
+	return merged
+}
+
+// renders each of the templates with the secrets, referencing a key the secrets don't have is an error
+func renderTemplates(folder string, templates Templates, secrets map[string]interface{}) ([]renderedTemplate, error) {
+	var rendered []renderedTemplate
+	seen := make(map[string]bool)
+	for _, x := range templates {
+		if x.Source == "" {
+			return nil, fmt.Errorf("template %s is missing a source", x.Output)
+		}
+		if !secretKeyRe.MatchString(x.Output) {
+			return nil, fmt.Errorf("template %s has an invalid output %q - must be a file name made of letters, digits, '-', '_' or '.'", x.Source, x.Output)
+		}
+		if seen[x.Output] {
+			return nil, fmt.Errorf("template output %s is defined more than once", x.Output)
+		}
+		seen[x.Output] = true
+		source := x.Source
+		if !filepath.IsAbs(source) {
+			source = filepath.Join(folder, source)
+		}
+		b, err := ioutil.ReadFile(source)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read template: %s", err)
+		}
+		var missing []string
+		tmpl, err := template.New(x.Source).Funcs(templateFuncs(&missing)).Option("missingkey=error").Parse(string(b))
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse template %s: %s", x.Source, err)
+		}
+		var buf bytes.Buffer
+		err = tmpl.Execute(&buf, secrets)
+		if err != nil {
+			return nil, fmt.Errorf("unable to render template %s: %s", x.Source, err)
+		}
+		rendered = append(rendered, renderedTemplate{TemplateDef: x, Contents: buf.Bytes()})
+	}
+	return rendered, nil
+}
+
+// renders the map's templates with every secret's values and adds each to its secret, keyed by output
+// a key set by both a template and the secret's values is an error
+func addTemplateSecrets(folder string, data SecretConfig, resolved []resolvedSecret) ([]resolvedSecret, error) {
+	if len(data.Templates) == 0 {
+		return resolved, nil
+	}
+	secrets, err := combineSecrets(resolved)
+	if err != nil {
+		return nil, err
+	}
+	rendered, err := renderTemplates(folder, data.Templates, secrets)
+	if err != nil {
+		return nil, err
+	}
+	for _, x := range rendered {
+		name := x.Secret
+		if name == "" {
+			name = data.SecretName
+		}
+		found := false
+		for i := range resolved {
+			if resolved[i].Name != name {
+				continue
+			}
+			if _, ok := resolved[i].Values[x.Output]; ok {
+				return nil, fmt.Errorf("template output %s is already a key in secret %s", x.Output, name)
+			}
+			values := make(map[string]interface{}, len(resolved[i].Values)+1)
+			for k, v := range resolved[i].Values {
+				values[k] = v
+			}
+			values[x.Output] = string(x.Contents)
+			resolved[i].Values = values
+			found = true
+		}
+		if !found {
+			return nil, fmt.Errorf("template %s: secret %s not found", x.Source, name)
+		}
+	}
+	return resolved, nil
+}
+
+// renders the map's templates and writes them to dir, named by their output, dir is created if needed
+func writeTemplateFiles(dir string, folder string, templates Templates, secrets map[string]interface{}) error {
+	rendered, err := renderTemplates(folder, templates, secrets)
+	if err != nil {
+		return err
+	}
+	if len(rendered) > 0 {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+	}
+	for _, x := range rendered {
+		filename := filepath.Join(dir, x.Output)
+		err := ioutil.WriteFile(filename, x.Contents, 0600)
+		if err != nil {
+			return err
+		}
+		log.Printf("created/updated template file: %s", filename)
+	}
+	return nil
+}
@@ -0,0 +1,275 @@
+package vaulthunter
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const templateAppFolder = "./../../mocks/vh/templateapp"
+
+// database.php rendered from the templateapp dev values
+const testDatabasePHP = `<?php
+$db['default'] = array(
+	'hostname' => 'localhost',
+	'username' => 'templateapp',
+	'password' => "p@ss\"word",
+);
+`
+
+// application.yml rendered from the templateapp dev values
+const testApplicationYML = `datasource:
+  url: jdbc:mysql://localhost/app
+  username: templateapp
+`
+
+// templateapp dev values
+var templateAppSecrets = map[string]interface{}{"DB_HOST": "localhost", "DB_USER": "templateapp", "DB_PASS": `p@ss"word`}
+
+func Test_mergeTemplates(t *testing.T) {
+	type args struct {
+		base Templates
+		env  Templates
+	}
+	tests := []struct {
+		name string
+		args args
+		want Templates
+	}{
+		{
+			name: "mergeTemplatesAppendTest",
+			args: args{
+				base: Templates{{Source: "a.tmpl", Output: "a.php"}},
+				env:  Templates{{Source: "b.tmpl", Output: "b.yml"}},
+			},
+			want: Templates{{Source: "a.tmpl", Output: "a.php"}, {Source: "b.tmpl", Output: "b.yml"}},
+		},
+		{
+			name: "mergeTemplatesReplaceTest",
+			args: args{
+				base: Templates{{Source: "a.tmpl", Output: "a.php"}, {Source: "b.tmpl", Output: "b.yml"}},
+				env:  Templates{{Source: "a-dev.tmpl", Output: "a.php", Secret: "files"}},
+			},
+			want: Templates{{Source: "a-dev.tmpl", Output: "a.php", Secret: "files"}, {Source: "b.tmpl", Output: "b.yml"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeTemplates(tt.args.base, tt.args.env); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeTemplates() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_renderTemplates(t *testing.T) {
+	type args struct {
+		templates Templates
+		secrets   map[string]interface{}
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "renderTemplatesTest",
+			args: args{
+				templates: Templates{
+					{Source: "templates/database.php.tmpl", Output: "database.php"},
+					{Source: "templates/application.yml.tmpl", Output: "application.yml"},
+				},
+				secrets: templateAppSecrets,
+			},
+			want: map[string]string{"database.php": testDatabasePHP, "application.yml": testApplicationYML},
+		},
+		{
+			name: "renderTemplatesMissingKeyTest",
+			args: args{
+				templates: Templates{{Source: "templates/missing.tmpl", Output: "missing.yml"}},
+				secrets:   templateAppSecrets,
+			},
+			wantErr: true,
+		},
+		{
+			name: "renderTemplatesMissingSourceTest",
+			args: args{
+				templates: Templates{{Source: "templates/nope.tmpl", Output: "nope.yml"}},
+				secrets:   templateAppSecrets,
+			},
+			wantErr: true,
+		},
+		{
+			name: "renderTemplatesInvalidOutputTest",
+			args: args{
+				templates: Templates{{Source: "templates/application.yml.tmpl", Output: "config/application.yml"}},
+				secrets:   templateAppSecrets,
+			},
+			wantErr: true,
+		},
+		{
+			name: "renderTemplatesDuplicateOutputTest",
+			args: args{
+				templates: Templates{
+					{Source: "templates/application.yml.tmpl", Output: "application.yml"},
+					{Source: "templates/database.php.tmpl", Output: "application.yml"},
+				},
+				secrets: templateAppSecrets,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rendered, err := renderTemplates(templateAppFolder, tt.args.templates, tt.args.secrets)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("renderTemplates() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			got := make(map[string]string)
+			for _, x := range rendered {
+				got[x.Output] = string(x.Contents)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("renderTemplates() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_addTemplateSecrets(t *testing.T) {
+	type args struct {
+		data     SecretConfig
+		resolved []resolvedSecret
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    map[string]map[string]interface{}
+		wantErr bool
+	}{
+		{
+			name: "addTemplateSecretsTest",
+			args: args{
+				data: SecretConfig{SecretName: "templateapp", Templates: Templates{
+					{Source: "templates/database.php.tmpl", Output: "database.php"},
+					{Source: "templates/application.yml.tmpl", Output: "application.yml", Secret: "templateapp-files"},
+				}},
+				resolved: []resolvedSecret{{Name: "templateapp", Values: templateAppSecrets}, {Name: "templateapp-files"}},
+			},
+			want: map[string]map[string]interface{}{
+				"templateapp":       {"DB_HOST": "localhost", "DB_USER": "templateapp", "DB_PASS": `p@ss"word`, "database.php": testDatabasePHP},
+				"templateapp-files": {"application.yml": testApplicationYML},
+			},
+		},
+		{
+			name: "addTemplateSecretsUnknownSecretTest",
+			args: args{
+				data:     SecretConfig{SecretName: "templateapp", Templates: Templates{{Source: "templates/database.php.tmpl", Output: "database.php", Secret: "nope"}}},
+				resolved: []resolvedSecret{{Name: "templateapp", Values: templateAppSecrets}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "addTemplateSecretsKeyCollisionTest",
+			args: args{
+				data:     SecretConfig{SecretName: "templateapp", Templates: Templates{{Source: "templates/database.php.tmpl", Output: "DB_HOST"}}},
+				resolved: []resolvedSecret{{Name: "templateapp", Values: templateAppSecrets}},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolved, err := addTemplateSecrets(templateAppFolder, tt.args.data, tt.args.resolved)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("addTemplateSecrets() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			got := make(map[string]map[string]interface{})
+			for _, x := range resolved {
+				got[x.Name] = x.Values
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("addTemplateSecrets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_writeTemplateFiles(t *testing.T) {
+	dir := t.TempDir()
+	templates := Templates{{Source: "templates/database.php.tmpl", Output: "database.php"}}
+	err := writeTemplateFiles(dir, templateAppFolder, templates, templateAppSecrets)
+	if err != nil {
+		t.Fatalf("writeTemplateFiles() error = %v", err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "database.php"))
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if string(b) != testDatabasePHP {
+		t.Errorf("writeTemplateFiles() wrote %q, want %q", b, testDatabasePHP)
+	}
+}
+
+// two apps with the same template output each get their own file
+func Test_generateEnvFilesTemplates(t *testing.T) {
+	dir := t.TempDir()
+	c := AppConfig{vhFolder: "./../../mocks/vh", configEnv: "dev", envFileDirectory: dir, format: "shell", apps: []string{"templateapp", "templateotherapp"}}
+	err := generateEnvFiles(c, nil)
+	if err != nil {
+		t.Fatalf("generateEnvFiles() error = %v", err)
+	}
+	want := map[string]string{
+		"templateapp":      testDatabasePHP,
+		"templateotherapp": "<?php\n$db['default'] = array(\n\t'hostname' => 'other.internal',\n\t'username' => 'templateotherapp',\n\t'password' => \"other-pass\",\n);\n",
+	}
+	for app, contents := range want {
+		b, err := ioutil.ReadFile(filepath.Join(dir, app, "database.php"))
+		if err != nil {
+			t.Errorf("ReadFile() error = %v", err)
+			continue
+		}
+		if string(b) != contents {
+			t.Errorf("generateEnvFiles() wrote %q for %s, want %q", b, app, contents)
+		}
+	}
+}
+
+func Test_createSecretsTemplates(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	c := AppConfig{vhFolder: "./../../mocks/vh", configEnv: "dev", kubeNamespace: "test", apps: []string{"templateapp"}}
+	err := createSecrets(c, nil, staticClients(clientset))
+	if err != nil {
+		t.Fatalf("createSecrets() error = %v", err)
+	}
+	want := map[string]map[string]string{
+		"templateapp":       {"database.php": testDatabasePHP},
+		"templateapp-files": {"application.yml": testApplicationYML},
+	}
+	for name, keys := range want {
+		secret, err := clientset.CoreV1().Secrets("test").Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			t.Errorf("secret %s not created: %v", name, err)
+			continue
+		}
+		for k, v := range keys {
+			if string(secret.Data[k]) != v {
+				t.Errorf("secret %s %s = %q, want %q", name, k, secret.Data[k], v)
+			}
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package vaulthunter
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strings"
+
+	vapi "github.com/hashicorp/vault/api"
+)
+
+// a full_secret_config_paths entry, written in a map as either just the path or an object
+// include/exclude are globs matched against the vault key, renamed keys are used as-is without case or prefix applied
+// recursive entries import every secret under the path, path_prefix prefixes their keys with the path below the entry
+// when two entries produce the same key the higher precedence wins, equal precedence is an error
+// unless one entry comes from the env map and the other from the base map, in which case the env map wins
+type FullSecretPath struct {
+	Path       string            `yaml:"path"`
+	Prefix     string            `yaml:"prefix,omitempty"`
+	Include    []string          `yaml:"include,omitempty"`
+	Exclude    []string          `yaml:"exclude,omitempty"`
+	Rename     map[string]string `yaml:"rename,omitempty"`
+	Case       string            `yaml:"case,omitempty"`
+	Precedence int               `yaml:"precedence,omitempty"`
+	Recursive  bool              `yaml:"recursive,omitempty"`
+	PathPrefix bool              `yaml:"path_prefix,omitempty"`
+	Raw        bool              `yaml:"raw,omitempty"`
+	// set while merging maps - fragments are -1, base maps are 0, env maps are 1
+	layer int
+	// set on the secrets found below a recursive entry
+	listed bool
+}
+
+type FullSecretConfigPaths []FullSecretPath
+
+// allows an entry to be written as just the secret path
+func (f *FullSecretPath) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var p string
+	if err := unmarshal(&p); err == nil {
+		f.Path = p
+		return nil
+	}
+	type plain FullSecretPath
+	return unmarshal((*plain)(f))
+}
+
+// grabs all k/v pairs from each full secret path
+func getFullSecrets(client *vapi.Client, paths FullSecretConfigPaths) (map[string]interface{}, error) {
+	secrets := make(map[string]interface{})
+	owners := make(map[string]FullSecretPath)
+	for _, x := range paths {
+		sources := []FullSecretPath{x}
+		if x.Recursive {
+			leaves, err := listSecretLeaves(client, x.Path)
+			if err != nil {
+				return nil, err
+			}
+			sources = nil
+			for _, l := range leaves {
+				leaf := x
+				leaf.Path = strings.TrimSuffix(x.Path, "/") + "/" + l
+				leaf.listed = true
+				if x.PathPrefix {
+					leaf.Prefix = x.Prefix + pathKeyPrefix(l)
+				}
+				sources = append(sources, leaf)
+			}
+		}
+		for _, y := range sources {
+			err := addFullSecret(client, y, secrets, owners)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return secrets, nil
+}
+
+// adds all k/v pairs from a single secret path to secrets
+func addFullSecret(client *vapi.Client, x FullSecretPath, secrets map[string]interface{}, owners map[string]FullSecretPath) error {
+	lookupPath := modSecretPath(x.Path)
+	m, deleted, err := readFullSecret(client, lookupPath)
+	if err != nil {
+		return err
+	}
+	// listing metadata also returns deleted secrets, those are skipped rather than failing the whole path
+	if deleted {
+		if x.listed {
+			log.Printf("WARN: skipping deleted secret %s", lookupPath)
+			return nil
+		}
+		return fmt.Errorf("secret %s is deleted - restore it in vault or remove it from full_secret_config_paths", lookupPath)
+	}
+	for k, v := range m {
+		name, ok, err := fullSecretKeyName(x, k)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			debugLog(fmt.Sprintf("DEBUG: skipping key %s from %s", k, x.Path), false)
+			continue
+		}
+		set, err := claimFullSecretKey(owners, name, x)
+		if err != nil {
+			return err
+		}
+		if !set {
+			continue
+		}
+		value := secretValueString(v)
+		if !x.Raw {
+			value = substituteEnvVars(value, lookupPath+"/"+k)
+		}
+		secrets[name] = value
+	}
+	return nil
+}
+
+// lists every secret below p in the kv metadata tree, returned relative to p and sorted
+func listSecretLeaves(client *vapi.Client, p string) ([]string, error) {
+	p = strings.TrimSuffix(p, "/")
+	listPath := modMetadataPath(p)
+	secret, err := client.Logical().List(listPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list %s: %s", listPath, err)
+	}
+	if secret == nil || secret.Data["keys"] == nil {
+		return nil, fmt.Errorf("no secrets found under %s - make sure the path exists in vault", listPath)
+	}
+	keys, ok := secret.Data["keys"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("could not decode list of %s", listPath)
+	}
+	var leaves []string
+	for _, k := range keys {
+		key := fmt.Sprintf("%v", k)
+		if !strings.HasSuffix(key, "/") {
+			leaves = append(leaves, key)
+			continue
+		}
+		folder := strings.TrimSuffix(key, "/")
+		children, err := listSecretLeaves(client, p+"/"+folder)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range children {
+			leaves = append(leaves, folder+"/"+c)
+		}
+	}
+	sort.Strings(leaves)
+	return leaves, nil
+}
+
+// key prefix derived from a secret's path below a recursive entry, ex. "db/main" becomes "DB_MAIN_"
+func pathKeyPrefix(p string) string {
+	r := strings.NewReplacer("/", "_", "-", "_", ".", "_")
+	return strings.ToUpper(r.Replace(p)) + "_"
+}
+
+// read all k/v pairs from a single secret, true if the current kv v2 version is deleted
+func readFullSecret(client *vapi.Client, lookupPath string) (map[string]interface{}, bool, error) {
+	secret, err := getSecret(lookupPath, client)
+	if err != nil {
+		return nil, false, err
+	}
+	if isDeletedVersion(secret) {
+		return nil, true, nil
+	}
+	m := secret.Data
+	if secret.Data["data"] != nil {
+		objects, ok := secret.Data["data"].(map[string]interface{})
+		// throw error if the lookupKey doesn't exist in the secrets object
+		if objects == nil {
+			return nil, false, fmt.Errorf("secret %s returned empty - make sure key for exists in vault", lookupPath)
+		}
+		if !ok {
+			return nil, false, fmt.Errorf("could not decode v2 secret")
+		}
+		m = objects
+	}
+	return m, false, nil
+}
+
+// env var name for a key pulled from a full secret path, false if the key is filtered out
+func fullSecretKeyName(x FullSecretPath, key string) (string, bool, error) {
+	if len(x.Include) > 0 {
+		matched, err := matchesAny(x.Include, key)
+		if err != nil || !matched {
+			return "", false, err
+		}
+	}
+	matched, err := matchesAny(x.Exclude, key)
+	if err != nil || matched {
+		return "", false, err
+	}
+	if r, ok := x.Rename[key]; ok {
+		return r, true, nil
+	}
+	name := key
+	switch x.Case {
+	case "", "upper":
+		name = strings.ToUpper(name)
+	case "preserve":
+	default:
+		return "", false, fmt.Errorf("invalid case %s for %s - must be upper or preserve", x.Case, x.Path)
+	}
+	return x.Prefix + name, true, nil
+}
+
+// checks if key matches any of the globs
+func matchesAny(globs []string, key string) (bool, error) {
+	for _, g := range globs {
+		matched, err := path.Match(g, key)
+		if err != nil {
+			return false, fmt.Errorf("invalid glob %s: %s", g, err)
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// records x as the source for name, returns false if an existing source takes precedence
+func claimFullSecretKey(owners map[string]FullSecretPath, name string, x FullSecretPath) (bool, error) {
+	owner, exists := owners[name]
+	if exists && owner.Path != x.Path {
+		switch {
+		case x.Precedence < owner.Precedence:
+			return false, nil
+		case x.Precedence == owner.Precedence && x.layer < owner.layer:
+			return false, nil
+		case x.Precedence == owner.Precedence && x.layer == owner.layer:
+			return false, fmt.Errorf("key %s is set by both %s and %s - set precedence on one of them", name, owner.Path, x.Path)
+		}
+	}
+	owners[name] = x
+	return true, nil
+}
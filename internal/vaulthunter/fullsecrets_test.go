@@ -0,0 +1,123 @@
+package vaulthunter
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func Test_FullSecretPath_UnmarshalYAML(t *testing.T) {
+	input := `
+- config/app-three/dev
+- path: config/app-three/base
+  prefix: BASE_
+  include: ["DB_*"]
+  exclude: ["DB_DEBUG"]
+  rename:
+    DB_HOST: DATABASE_HOST
+  case: preserve
+  precedence: 2
+`
+	want := FullSecretConfigPaths{
+		{Path: "config/app-three/dev"},
+		{
+			Path:       "config/app-three/base",
+			Prefix:     "BASE_",
+			Include:    []string{"DB_*"},
+			Exclude:    []string{"DB_DEBUG"},
+			Rename:     map[string]string{"DB_HOST": "DATABASE_HOST"},
+			Case:       "preserve",
+			Precedence: 2,
+		},
+	}
+	var got FullSecretConfigPaths
+	if err := yaml.Unmarshal([]byte(input), &got); err != nil {
+		t.Fatalf("UnmarshalYAML() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("UnmarshalYAML() = %v, want %v", got, want)
+	}
+}
+
+func Test_fullSecretKeyName(t *testing.T) {
+	type args struct {
+		x   FullSecretPath
+		key string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    string
+		wantOk  bool
+		wantErr bool
+	}{
+		{name: "defaultUpperTest", args: args{x: FullSecretPath{Path: "a"}, key: "log_level"}, want: "LOG_LEVEL", wantOk: true},
+		{name: "preservePrefixTest", args: args{x: FullSecretPath{Path: "a", Prefix: "APP_", Case: "preserve"}, key: "log_level"}, want: "APP_log_level", wantOk: true},
+		{name: "renameTest", args: args{x: FullSecretPath{Path: "a", Prefix: "APP_", Rename: map[string]string{"log_level": "LOGGING"}}, key: "log_level"}, want: "LOGGING", wantOk: true},
+		{name: "includeTest", args: args{x: FullSecretPath{Path: "a", Include: []string{"db_*"}}, key: "log_level"}, wantOk: false},
+		{name: "excludeTest", args: args{x: FullSecretPath{Path: "a", Exclude: []string{"log_*"}}, key: "log_level"}, wantOk: false},
+		{name: "invalidCaseTest", args: args{x: FullSecretPath{Path: "a", Case: "lower"}, key: "log_level"}, wantErr: true},
+		{name: "invalidGlobTest", args: args{x: FullSecretPath{Path: "a", Include: []string{"[log"}}, key: "log_level"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotOk, err := fullSecretKeyName(tt.args.x, tt.args.key)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("fullSecretKeyName() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want || gotOk != tt.wantOk {
+				t.Errorf("fullSecretKeyName() = %v, %v, want %v, %v", got, gotOk, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func Test_claimFullSecretKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		owner   FullSecretPath
+		x       FullSecretPath
+		want    bool
+		wantErr bool
+	}{
+		{name: "collisionTest", owner: FullSecretPath{Path: "a"}, x: FullSecretPath{Path: "b"}, wantErr: true},
+		{name: "samePathTest", owner: FullSecretPath{Path: "a"}, x: FullSecretPath{Path: "a"}, want: true},
+		{name: "higherPrecedenceTest", owner: FullSecretPath{Path: "a"}, x: FullSecretPath{Path: "b", Precedence: 1}, want: true},
+		{name: "lowerPrecedenceTest", owner: FullSecretPath{Path: "a", Precedence: 1}, x: FullSecretPath{Path: "b"}, want: false},
+		{name: "envLayerTest", owner: FullSecretPath{Path: "a"}, x: FullSecretPath{Path: "b", layer: 1}, want: true},
+		{name: "fragmentLayerTest", owner: FullSecretPath{Path: "a"}, x: FullSecretPath{Path: "b", layer: -1}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			owners := map[string]FullSecretPath{"KEY": tt.owner}
+			got, err := claimFullSecretKey(owners, "KEY", tt.x)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("claimFullSecretKey() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("claimFullSecretKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_pathKeyPrefix(t *testing.T) {
+	tests := []struct {
+		name string
+		p    string
+		want string
+	}{
+		{name: "pathKeyPrefixTest", p: "api", want: "API_"},
+		{name: "pathKeyPrefixNestedTest", p: "db/read-only", want: "DB_READ_ONLY_"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pathKeyPrefix(tt.p); got != tt.want {
+				t.Errorf("pathKeyPrefix() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package vaulthunter
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// a node in the dependency graph
+// kinds are project, role, policy, app, env, var and path
+type graphNode struct {
+	ID    string `json:"id"`
+	Kind  string `json:"kind"`
+	Label string `json:"label"`
+}
+
+type graphEdge struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Label string `json:"label,omitempty"`
+}
+
+// who can read what - ci project -> role -> policy -> vault path, and app -> env -> env var -> vault path
+type secretGraph struct {
+	Nodes []graphNode `json:"nodes"`
+	Edges []graphEdge `json:"edges"`
+	nodes map[string]bool
+	edges map[graphEdge]bool
+}
+
+// adds a node once, returns its id
+func (g *secretGraph) node(kind string, key string, label string) string {
+	id := kind + ":" + key
+	if g.nodes == nil {
+		g.nodes = make(map[string]bool)
+	}
+	if !g.nodes[id] {
+		g.nodes[id] = true
+		g.Nodes = append(g.Nodes, graphNode{ID: id, Kind: kind, Label: label})
+	}
+	return id
+}
+
+// adds an edge once
+func (g *secretGraph) edge(from string, to string, label string) {
+	e := graphEdge{From: from, To: to, Label: label}
+	if g.edges == nil {
+		g.edges = make(map[graphEdge]bool)
+	}
+	if !g.edges[e] {
+		g.edges[e] = true
+		g.Edges = append(g.Edges, e)
+	}
+}
+
+// builds the graph from every app/env map and the roles and policies generate-policies would create
+// vault paths are the api paths policies grant, ex. secret/data/app-one/dev
+func buildGraph(c AppConfig) (*secretGraph, error) {
+	g := &secretGraph{}
+	for _, app := range c.apps {
+		folder := c.vhFolder + "/" + app
+		envs, err := getEnvs(folder)
+		if err != nil {
+			return nil, err
+		}
+		appID := g.node("app", app, app)
+		for _, env := range envs {
+			envID := g.node("env", app+"/"+env, env)
+			g.edge(appID, envID, "")
+			data := mergeConfig(folder, env)
+			defs, err := data.secretDefs()
+			if err != nil {
+				return nil, fmt.Errorf("%s/%s: %s", app, env, err)
+			}
+			for _, d := range defs {
+				addSecretDefToGraph(g, envID, app+"/"+env+"/"+d.Name, d)
+			}
+		}
+	}
+	units, err := policyUnits(c)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range units {
+		roleID := g.node("role", u.Name, u.Name)
+		if u.ProjectID != "" {
+			g.edge(g.node("project", u.ProjectID, "project "+u.ProjectID), roleID, "")
+		}
+		// policies link to the paths as written, collapsed and globbed grants then link back to the paths vars read
+		written, err := envPolicyPaths(c.vhFolder, u.Apps, u.Env)
+		if err != nil {
+			return nil, err
+		}
+		referenced, err := envReferencedPaths(c.vhFolder, u.Apps, u.Env)
+		if err != nil {
+			return nil, err
+		}
+		for i, policy := range u.Policies {
+			policyID := g.node("policy", policy, policy)
+			g.edge(roleID, policyID, "")
+			// only the env's own policy is generated from these maps, -dependent-apps policies come from theirs
+			if i > 0 {
+				continue
+			}
+			for _, p := range written {
+				w := writtenPolicyPath(p.path)
+				g.edge(policyID, g.node("path", w, w), strings.Join(p.capabilities, ","))
+			}
+			addGrantsToGraph(g, written, referenced)
+		}
+	}
+	return g, nil
+}
+
+// links each referenced path the policy doesn't write as-is to the grants covering it
+func addGrantsToGraph(g *secretGraph, written []policyPath, referenced []policyPath) {
+	exact := make(map[string]bool)
+	for _, p := range written {
+		exact[writtenPolicyPath(p.path)] = true
+	}
+	for _, r := range referenced {
+		if exact[r.path] {
+			continue
+		}
+		for _, p := range written {
+			w := writtenPolicyPath(p.path)
+			if reflect.DeepEqual(p.capabilities, denyCapabilities) || !policyPathMatches(w, r.path) {
+				continue
+			}
+			g.edge(g.node("path", r.path, r.path), g.node("path", w, w), "covered by")
+		}
+	}
+}
+
+// adds a secret's env vars and the vault paths they read
+func addSecretDefToGraph(g *secretGraph, envID string, key string, d SecretDef) {
+	names := make([]string, 0, len(d.KeyConfig))
+	for k := range d.KeyConfig {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		k := d.KeyConfig[name]
+		varID := g.node("var", key+"/"+name, name)
+		g.edge(envID, varID, "")
+		for _, src := range keyDefSources(k) {
+			p := modSecretPath(src[0])
+			g.edge(varID, g.node("path", p, p), src[1])
+		}
+	}
+	for _, x := range d.FullSecretConfigPaths {
+		name := x.Prefix + "*"
+		varID := g.node("var", key+"/"+name, name)
+		g.edge(envID, varID, "")
+		for _, p := range fullSecretPolicyPaths(x) {
+			// recursive entries also list the metadata tree, only the data they read is linked to the var
+			if strings.Contains(p.path, "/metadata/") {
+				continue
+			}
+			g.edge(varID, g.node("path", p.path, p.path), "")
+		}
+	}
+}
+
+// path and key pairs read when resolving a key, including its inputs
+func keyDefSources(k KeyDef) [][2]string {
+	var sources [][2]string
+	if k.Path != "" {
+		sources = append(sources, [2]string{k.Path, k.Key})
+	}
+	inputs := make([]string, 0, len(k.Inputs))
+	for x := range k.Inputs {
+		inputs = append(inputs, x)
+	}
+	sort.Strings(inputs)
+	for _, x := range inputs {
+		sources = append(sources, keyDefSources(k.Inputs[x])...)
+	}
+	return sources
+}
+
+// dot shapes for each kind of node
+var graphShapes = map[string]string{
+	"project": "house",
+	"role":    "diamond",
+	"policy":  "note",
+	"app":     "box3d",
+	"env":     "folder",
+	"var":     "ellipse",
+	"path":    "cylinder",
+}
+
+// renders the graph as graphviz dot, mermaid or json
+func formatGraph(g *secretGraph, format string) (string, error) {
+	var b strings.Builder
+	switch format {
+	case "", "dot":
+		dotEscaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+		b.WriteString("digraph vault_hunter {\n  rankdir=LR;\n")
+		for _, n := range g.Nodes {
+			fmt.Fprintf(&b, "  \"%s\" [label=\"%s\", shape=%s];\n", dotEscaper.Replace(n.ID), dotEscaper.Replace(n.Label), graphShapes[n.Kind])
+		}
+		for _, e := range g.Edges {
+			fmt.Fprintf(&b, "  \"%s\" -> \"%s\"", dotEscaper.Replace(e.From), dotEscaper.Replace(e.To))
+			if e.Label != "" {
+				fmt.Fprintf(&b, " [label=\"%s\"]", dotEscaper.Replace(e.Label))
+			}
+			b.WriteString(";\n")
+		}
+		b.WriteString("}\n")
+	case "mermaid":
+		// mermaid ids can't hold most punctuation, nodes are numbered instead
+		mermaidEscaper := strings.NewReplacer(`"`, "#quot;", "|", "#124;")
+		ids := make(map[string]string)
+		b.WriteString("flowchart LR\n")
+		for i, n := range g.Nodes {
+			ids[n.ID] = fmt.Sprintf("n%d", i)
+			fmt.Fprintf(&b, "  %s[\"%s: %s\"]\n", ids[n.ID], n.Kind, mermaidEscaper.Replace(n.Label))
+		}
+		for _, e := range g.Edges {
+			if e.Label != "" {
+				fmt.Fprintf(&b, "  %s -->|%s| %s\n", ids[e.From], mermaidEscaper.Replace(e.Label), ids[e.To])
+				continue
+			}
+			fmt.Fprintf(&b, "  %s --> %s\n", ids[e.From], ids[e.To])
+		}
+	case "json":
+		j, err := json.MarshalIndent(g, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		b.Write(j)
+		b.WriteString("\n")
+	default:
+		return "", fmt.Errorf("unknown graph format: %s - must be dot, mermaid or json", format)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,158 @@
+package vaulthunter
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func Test_buildGraph(t *testing.T) {
+	c := AppConfig{vhFolder: "./../../mocks/vh", apps: []string{"rotateapp"}, policyPrefix: "vh", appName: "testycat", projectID: "60", dependencyApps: "shared"}
+	g, err := buildGraph(c)
+	if err != nil {
+		t.Fatalf("buildGraph() error = %v", err)
+	}
+	wantEdges := []graphEdge{
+		{From: "app:rotateapp", To: "env:rotateapp/dev"},
+		{From: "env:rotateapp/dev", To: "var:rotateapp/dev/rotateapp/RABBIT_PASS"},
+		{From: "var:rotateapp/dev/rotateapp/RABBIT_PASS", To: "path:secret/data/location/one/config/rotate", Label: "password"},
+		{From: "env:rotateapp/prod", To: "var:rotateapp/prod/rotateapp-rabbit/RABBIT_*"},
+		{From: "var:rotateapp/prod/rotateapp-rabbit/RABBIT_*", To: "path:secret/data/location/one/config/rotate"},
+		{From: "project:60", To: "role:vh-testycat-dev"},
+		{From: "role:vh-testycat-prod", To: "policy:vh-testycat-prod"},
+		{From: "role:vh-testycat-prod", To: "policy:vh-shared-prod"},
+		{From: "policy:vh-testycat-prod", To: "path:secret/data/location/one/config/rotate", Label: "read"},
+	}
+	edges := make(map[graphEdge]bool)
+	for _, e := range g.Edges {
+		if edges[e] {
+			t.Errorf("buildGraph() duplicate edge %v", e)
+		}
+		edges[e] = true
+	}
+	for _, e := range wantEdges {
+		if !edges[e] {
+			t.Errorf("buildGraph() missing edge %v", e)
+		}
+	}
+	for _, e := range g.Edges {
+		if e.From == "policy:vh-shared-prod" {
+			t.Errorf("buildGraph() dependent app policy has edge %v", e)
+		}
+	}
+	nodes := make(map[string]bool)
+	for _, n := range g.Nodes {
+		nodes[n.ID] = true
+	}
+	for _, e := range g.Edges {
+		if !nodes[e.From] || !nodes[e.To] {
+			t.Errorf("buildGraph() edge %v references a missing node", e)
+		}
+	}
+}
+
+// policy options rewrite the written paths, the paths vars read are linked to the grants covering them
+func Test_buildGraphPolicyOptions(t *testing.T) {
+	c := AppConfig{vhFolder: "./../../mocks/vh", apps: []string{"optionsapp"}, policyPrefix: "vh", appName: "testycat", projectID: "60"}
+	g, err := buildGraph(c)
+	if err != nil {
+		t.Fatalf("buildGraph() error = %v", err)
+	}
+	edges := make(map[graphEdge]bool)
+	for _, e := range g.Edges {
+		edges[e] = true
+		if e.From == "policy:vh-testycat-dev" && e.To == "path:secret/data/optionsapp/dev/db" {
+			t.Errorf("buildGraph() edge %v to a path the policy doesn't write", e)
+		}
+		if e.Label == "covered by" && strings.Contains(e.To, "/root/") {
+			t.Errorf("buildGraph() edge %v to a deny block", e)
+		}
+	}
+	for _, e := range []graphEdge{
+		{From: "var:optionsapp/dev/optionsapp/DB_USER", To: "path:secret/data/optionsapp/dev/db", Label: "user"},
+		{From: "policy:vh-testycat-dev", To: "path:secret/data/optionsapp/dev/*", Label: "read"},
+		{From: "path:secret/data/optionsapp/dev/db", To: "path:secret/data/optionsapp/dev/*", Label: "covered by"},
+		{From: "var:optionsapp/dev/optionsapp/*", To: "path:config/data/optionsapp/dev"},
+		{From: "policy:vh-testycat-dev", To: "path:config/data/optionsapp/dev*", Label: "read"},
+		{From: "path:config/data/optionsapp/dev", To: "path:config/data/optionsapp/dev*", Label: "covered by"},
+		{From: "policy:vh-testycat-dev", To: "path:secret/data/shared/dev/token", Label: "read"},
+		{From: "policy:vh-testycat-dev", To: "path:secret/metadata/optionsapp/dev", Label: "list"},
+		{From: "policy:vh-testycat-dev", To: "path:secret/data/optionsapp/dev/root/*", Label: "deny"},
+	} {
+		if !edges[e] {
+			t.Errorf("buildGraph() missing edge %v", e)
+		}
+	}
+}
+
+// small graph with characters needing escaping
+func testGraph() *secretGraph {
+	g := &secretGraph{}
+	role := g.node("role", "vh-app-dev", "vh-app-dev")
+	policy := g.node("policy", "vh-app-dev", "vh-app-dev")
+	path := g.node("path", `secret/data/a"b`, `secret/data/a"b`)
+	g.edge(role, policy, "")
+	g.edge(policy, path, "read")
+	g.edge(policy, path, "read")
+	return g
+}
+
+func Test_formatGraph(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "formatGraphDotTest",
+			format: "dot",
+			want: `digraph vault_hunter {
+  rankdir=LR;
+  "role:vh-app-dev" [label="vh-app-dev", shape=diamond];
+  "policy:vh-app-dev" [label="vh-app-dev", shape=note];
+  "path:secret/data/a\"b" [label="secret/data/a\"b", shape=cylinder];
+  "role:vh-app-dev" -> "policy:vh-app-dev";
+  "policy:vh-app-dev" -> "path:secret/data/a\"b" [label="read"];
+}
+`,
+		},
+		{
+			name:   "formatGraphMermaidTest",
+			format: "mermaid",
+			want: `flowchart LR
+  n0["role: vh-app-dev"]
+  n1["policy: vh-app-dev"]
+  n2["path: secret/data/a#quot;b"]
+  n0 --> n1
+  n1 -->|read| n2
+`,
+		},
+		{name: "formatGraphUnknownTest", format: "png", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := formatGraph(testGraph(), tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("formatGraph() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("formatGraph() = \n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+	t.Run("formatGraphJSONTest", func(t *testing.T) {
+		got, err := formatGraph(testGraph(), "json")
+		if err != nil {
+			t.Fatalf("formatGraph() error = %v", err)
+		}
+		var g secretGraph
+		if err := json.Unmarshal([]byte(got), &g); err != nil {
+			t.Fatalf("json.Unmarshal() error = %v", err)
+		}
+		if len(g.Nodes) != 3 || len(g.Edges) != 2 || g.Edges[1].Label != "read" {
+			t.Errorf("formatGraph() = %s", got)
+		}
+	})
+}
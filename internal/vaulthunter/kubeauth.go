@@ -0,0 +1,134 @@
+package vaulthunter
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	vapi "github.com/hashicorp/vault/api"
+)
+
+// a kubernetes service account allowed to log in with the env's generated policies
+type ServiceAccount struct {
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace"`
+}
+
+type ServiceAccounts []ServiceAccount
+
+// auth/kubernetes role
+type KubernetesRole struct {
+	BoundServiceAccountNames      []string `json:"bound_service_account_names"`
+	BoundServiceAccountNamespaces []string `json:"bound_service_account_namespaces"`
+	Policies                      []string `json:"policies"`
+}
+
+// a generated kubernetes role, file is the generated file name without extension
+type kubernetesRoleDef struct {
+	Name string
+	File string
+	Role KubernetesRole
+}
+
+// splits -role-type into role types, ex. jwt,kubernetes - defaults to jwt
+func parseRoleTypes(s string) ([]string, error) {
+	if s == "" {
+		return []string{"jwt"}, nil
+	}
+	var types []string
+	for _, x := range strings.Split(s, ",") {
+		x = strings.TrimSpace(x)
+		if x == "" {
+			continue
+		}
+		if _, ok := roleTypeMounts[x]; !ok {
+			return nil, fmt.Errorf("unknown role type: %s - must be jwt or kubernetes", x)
+		}
+		if !containsString(types, x) {
+			types = append(types, x)
+		}
+	}
+	if len(types) == 0 {
+		return nil, fmt.Errorf("no role type given - must be jwt or kubernetes")
+	}
+	return types, nil
+}
+
+// service accounts declared in the env's maps of every app in the unit
+func unitServiceAccounts(vhFolder string, u policyUnit) (ServiceAccounts, error) {
+	var accounts ServiceAccounts
+	for _, app := range u.Apps {
+		folder := vhFolder + "/" + app
+		if !fileExists(folder + "/" + u.Env + ".yaml") {
+			continue
+		}
+		for _, x := range mergeConfig(folder, u.Env).ServiceAccounts {
+			if x.Name == "" || x.Namespace == "" {
+				return nil, fmt.Errorf("%s/%s: service_accounts entries need a name and namespace", app, u.Env)
+			}
+			if !containsServiceAccount(accounts, x) {
+				accounts = append(accounts, x)
+			}
+		}
+	}
+	return accounts, nil
+}
+
+func containsServiceAccount(accounts ServiceAccounts, a ServiceAccount) bool {
+	for _, x := range accounts {
+		if x == a {
+			return true
+		}
+	}
+	return false
+}
+
+// kubernetes roles for a unit's service accounts, attached to the unit's policies
+// kubernetes auth allows every bound name in every bound namespace, so a <role>-<namespace> role is generated per namespace
+// names are always namespace qualified so adding a namespace doesn't leave a differently named role behind
+func kubernetesRoles(vhFolder string, u policyUnit) ([]kubernetesRoleDef, error) {
+	accounts, err := unitServiceAccounts(vhFolder, u)
+	if err != nil {
+		return nil, err
+	}
+	byNamespace := make(map[string][]string)
+	var namespaces []string
+	for _, x := range accounts {
+		if _, ok := byNamespace[x.Namespace]; !ok {
+			namespaces = append(namespaces, x.Namespace)
+		}
+		byNamespace[x.Namespace] = append(byNamespace[x.Namespace], x.Name)
+	}
+	sort.Strings(namespaces)
+	var roles []kubernetesRoleDef
+	for _, ns := range namespaces {
+		names := byNamespace[ns]
+		sort.Strings(names)
+		def := kubernetesRoleDef{
+			Name: u.Name + "-" + ns,
+			File: u.File + "-kubernetes-" + ns,
+			Role: KubernetesRole{
+				BoundServiceAccountNames:      names,
+				BoundServiceAccountNamespaces: []string{ns},
+				Policies:                      u.Policies,
+			},
+		}
+		roles = append(roles, def)
+	}
+	return roles, nil
+}
+
+// deletes a unit's kubernetes role named without a namespace, as roles for a single namespace used to be
+// a missing role is not an error
+func deleteUnqualifiedKubernetesRole(mount string, roleName string, client *vapi.Client) error {
+	existing, err := client.Logical().Read("auth/" + mount + "/role/" + roleName)
+	if err != nil {
+		return fmt.Errorf("unable to read role %s: %s", roleName, err)
+	}
+	if existing == nil {
+		return nil
+	}
+	log.Printf("WARN: kubernetes roles are now named per namespace, deleting %s", roleName)
+	return deleteRole(mount, roleName, client)
+}
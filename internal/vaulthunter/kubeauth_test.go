@@ -0,0 +1,137 @@
+package vaulthunter
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func Test_parseRoleTypes(t *testing.T) {
+	type args struct {
+		s string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    []string
+		wantErr bool
+	}{
+		{name: "testParseRoleTypesDefault", args: args{s: ""}, want: []string{"jwt"}},
+		{name: "testParseRoleTypesKubernetes", args: args{s: "kubernetes"}, want: []string{"kubernetes"}},
+		{name: "testParseRoleTypesBoth", args: args{s: "jwt, kubernetes,jwt"}, want: []string{"jwt", "kubernetes"}},
+		{name: "testParseRoleTypesUnknown", args: args{s: "jwt,approle"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRoleTypes(tt.args.s)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseRoleTypes() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseRoleTypes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_kubernetesRoles(t *testing.T) {
+	type args struct {
+		vhFolder string
+		u        policyUnit
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    []kubernetesRoleDef
+		wantErr bool
+	}{
+		{
+			name: "testKubernetesRolesCombined",
+			args: args{
+				vhFolder: "./../../mocks/vh",
+				u:        policyUnit{Name: "vh-testycat-dev", File: "testycat-dev", Env: "dev", Apps: []string{"rotateapp", "seedapp"}, Policies: []string{"vh-testycat-dev", "vh-shared-dev"}},
+			},
+			want: []kubernetesRoleDef{
+				{
+					Name: "vh-testycat-dev-rotate-dev",
+					File: "testycat-dev-kubernetes-rotate-dev",
+					Role: KubernetesRole{
+						BoundServiceAccountNames:      []string{"rotate-sync", "seed-sync"},
+						BoundServiceAccountNamespaces: []string{"rotate-dev"},
+						Policies:                      []string{"vh-testycat-dev", "vh-shared-dev"},
+					},
+				},
+			},
+		},
+		{
+			name: "testKubernetesRolesPerNamespace",
+			args: args{
+				vhFolder: "./../../mocks/vh",
+				u:        policyUnit{Name: "vh-rotateapp-prod", File: "rotateapp-prod", Env: "prod", Apps: []string{"rotateapp", "seedapp"}, Policies: []string{"vh-rotateapp-prod"}},
+			},
+			want: []kubernetesRoleDef{
+				{
+					Name: "vh-rotateapp-prod-rotate-batch",
+					File: "rotateapp-prod-kubernetes-rotate-batch",
+					Role: KubernetesRole{
+						BoundServiceAccountNames:      []string{"rotate-sync"},
+						BoundServiceAccountNamespaces: []string{"rotate-batch"},
+						Policies:                      []string{"vh-rotateapp-prod"},
+					},
+				},
+				{
+					Name: "vh-rotateapp-prod-rotate-prod",
+					File: "rotateapp-prod-kubernetes-rotate-prod",
+					Role: KubernetesRole{
+						BoundServiceAccountNames:      []string{"rotate-sync", "rotate-worker"},
+						BoundServiceAccountNamespaces: []string{"rotate-prod"},
+						Policies:                      []string{"vh-rotateapp-prod"},
+					},
+				},
+			},
+		},
+		{
+			name: "testKubernetesRolesNone",
+			args: args{
+				vhFolder: "./../../mocks/vh",
+				u:        policyUnit{Name: "vh-multiapp-dev", File: "multiapp-dev", Env: "dev", Apps: []string{"multiapp"}, Policies: []string{"vh-multiapp-dev"}},
+			},
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := kubernetesRoles(tt.args.vhFolder, tt.args.u)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("kubernetesRoles() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("kubernetesRoles() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_genAllRolesAndPoliciesKubernetes(t *testing.T) {
+	c := AppConfig{vhFolder: "./../../mocks/vh", apps: []string{"rotateapp"}, policyPrefix: "vh", policyScope: "per-app", roleTypes: "kubernetes", policyLockProdClaims: true}
+	t.Cleanup(func() {
+		os.RemoveAll("./../../mocks/vh/generated")
+	})
+	if err := genAllRolesAndPolicies(c, nil); err != nil {
+		t.Fatalf("genAllRolesAndPolicies() error = %v", err)
+	}
+	files := map[string]bool{
+		"policies/rotateapp-dev.hcl":                        true,
+		"roles/rotateapp-dev-kubernetes-rotate-dev.json":    true,
+		"roles/rotateapp-prod-kubernetes-rotate-prod.json":  true,
+		"roles/rotateapp-prod-kubernetes-rotate-batch.json": true,
+		"roles/rotateapp-dev.json":                          false,
+	}
+	for f, want := range files {
+		if got := fileExists("./../../mocks/vh/generated/" + f); got != want {
+			t.Errorf("generated %s exists = %v, want %v", f, got, want)
+		}
+	}
+}
@@ -19,20 +19,33 @@ import (
 )
 
 type VaultRole struct {
-	RoleType            string      `json:"role_type"`
-	Policies            []string    `json:"policies"`
-	TokenExplicitMaxTTL int         `json:"token_explicit_max_ttl"`
-	UserClaim           string      `json:"user_claim"`
-	BoundClaimsType     string      `json:"bound_claims_type"`
-	BoundClaims         BoundClaims `json:"bound_claims"`
+	RoleType            string            `json:"role_type"`
+	Policies            []string          `json:"policies"`
+	TokenExplicitMaxTTL int               `json:"token_explicit_max_ttl"`
+	UserClaim           string            `json:"user_claim"`
+	BoundClaimsType     string            `json:"bound_claims_type"`
+	BoundClaims         BoundClaims       `json:"bound_claims"`
+	TokenTTL            int               `json:"token_ttl,omitempty"`
+	TokenMaxTTL         int               `json:"token_max_ttl,omitempty"`
+	BoundAudiences      []string          `json:"bound_audiences,omitempty"`
+	ClaimMappings       map[string]string `json:"claim_mappings,omitempty"`
+	TokenBoundCIDRs     []string          `json:"token_bound_cidrs,omitempty"`
 }
 
-type BoundClaims struct {
-	ProjectID string `json:"project_id"`
-	Ref       string `json:"ref,omitempty"`
-	RefType   string `json:"ref_type,omitempty"`
+// claim values are a string or a list of strings, ex. project_id, ref, ref_type, namespace_path
+type BoundClaims map[string]interface{}
+
+// a single path entry in a generated policy
+type policyPath struct {
+	path         string
+	capabilities []string
 }
 
+var (
+	readCapabilities = []string{"read"}
+	listCapabilities = []string{"list"}
+)
+
 // apply vault policy
 func applyPolicy(policyName string, filename string, client *vapi.Client) error {
 	var reader io.Reader
@@ -56,31 +69,31 @@ func applyPolicy(policyName string, filename string, client *vapi.Client) error
 	return nil
 }
 
-// apply auth/jwt/role
-func applyRole(roleName string, filename string, client *vapi.Client) error {
+// apply role to the auth method mounted at mount, ex. auth/jwt/role
+func applyRole(mount string, roleName string, filename string, client *vapi.Client) error {
 	jsondata, err := ioutil.ReadFile(filename)
 	if err != nil {
 		return err
 	}
 	var j map[string]interface{}
 	json.Unmarshal(jsondata, &j)
-	path := "auth/jwt/role/" + roleName
+	path := "auth/" + mount + "/role/" + roleName
 	_, err = client.Logical().Write(path, j)
 	if err != nil {
 		return err
 	}
-	log.Printf("INFO: successfully created/updated role: %s", roleName)
+	log.Printf("INFO: successfully created/updated role: %s", path)
 	return nil
 }
 
-// delete role from vault
-func deleteRole(roleName string, client *vapi.Client) error {
-	path := "auth/jwt/role/" + roleName
+// delete role from the auth method mounted at mount
+func deleteRole(mount string, roleName string, client *vapi.Client) error {
+	path := "auth/" + mount + "/role/" + roleName
 	_, err := client.Logical().Delete(path)
 	if err != nil {
 		return err
 	}
-	log.Printf("INFO: deleted role: %s", roleName)
+	log.Printf("INFO: deleted role: %s", path)
 	return nil
 }
 
@@ -96,31 +109,47 @@ func deletePolicy(policyName string, client *vapi.Client) error {
 
 // delete all roles and policies for this app from vault
 func deleteAllPoliciesAndRoles(c AppConfig, client *vapi.Client) error {
-	prefix := c.policyPrefix + "-"
-	var envs []string
-	// find all all envs in all apps
-	for _, x := range c.apps {
-		e, err := getEnvs(c.vhFolder + "/" + x)
-		if err != nil {
-			return err
-		}
-		for _, y := range e {
-			if !containsString(envs, y) {
-				envs = append(envs, y)
-			}
-		}
+	units, err := policyUnits(c)
+	if err != nil {
+		return err
+	}
+	roleTypes, err := parseRoleTypes(c.roleTypes)
+	if err != nil {
+		return err
+	}
+	err = checkRoleMounts(c, client, units, roleTypes)
+	if err != nil {
+		return err
 	}
 
-	// for each env, delete policy/role for that prefix+mainAppName+env
-	for _, x := range envs {
-		name := prefix + c.appName + "-" + x
+	// delete each generated policy/role
+	for _, u := range units {
+		name := u.Name
 		err := deletePolicy(name, client)
 		if err != nil {
 			return err
 		}
-		err = deleteRole(name, client)
-		if err != nil {
-			return err
+		if containsString(roleTypes, "jwt") {
+			err = deleteRole(roleMount(c, u, "jwt"), name, client)
+			if err != nil {
+				return err
+			}
+		}
+		if containsString(roleTypes, "kubernetes") {
+			kroles, err := kubernetesRoles(c.vhFolder, u)
+			if err != nil {
+				return err
+			}
+			for _, r := range kroles {
+				err = deleteRole(roleMount(c, u, "kubernetes"), r.Name, client)
+				if err != nil {
+					return err
+				}
+			}
+			err = deleteUnqualifiedKubernetesRole(roleMount(c, u, "kubernetes"), name, client)
+			if err != nil {
+				return err
+			}
 		}
 	}
 	log.Printf("deleted all policies and roles from vault")
@@ -172,7 +201,6 @@ func getEnvs(appFolder string) (envs []string, err error) {
 
 // generate all apply all vault policies and roles for this app
 func genAllRolesAndPolicies(c AppConfig, client *vapi.Client) error {
-	prefix := c.policyPrefix + "-"
 	genFolder(c.vhFolder)
 	log.Printf("INFO: finding policies for %s", c.appName)
 	policyFolder := c.vhFolder + "/generated/policies"
@@ -182,65 +210,105 @@ func genAllRolesAndPolicies(c AppConfig, client *vapi.Client) error {
 	// for _, x := range c.apps {
 
 	// }
-	var envs []string
-	// find all all envs in all apps
-	for _, x := range c.apps {
-		e, err := getEnvs(c.vhFolder + "/" + x)
+	units, err := policyUnits(c)
+	if err != nil {
+		return err
+	}
+	roleTypes, err := parseRoleTypes(c.roleTypes)
+	if err != nil {
+		return err
+	}
+	// nothing is written to vault unless every role's auth mount exists
+	if c.applyConfig {
+		err = checkRoleMounts(c, client, units, roleTypes)
 		if err != nil {
 			return err
 		}
-		for _, y := range e {
-			if !containsString(envs, y) {
-				envs = append(envs, y)
-			}
-		}
 	}
-	// log.Printf("envs: %s", envs)
-	// envs, err := getEnvs(c.vhFolder)
-	// if err != nil {
-	// 	return (err)
-	// }
-
-	for _, x := range envs {
-		debugLog(fmt.Sprintf("env processed: %s", x), false)
+	rconfig, err := parseRoles(c.vhFolder)
+	if err != nil {
+		return err
+	}
+	var envs []string
+	for _, u := range units {
+		envs = append(envs, u.Env)
+	}
+	for _, x := range unknownRoleEnvs(rconfig, envs) {
+		log.Printf("WARN: %s overrides env %s, which no app defines", rolesFile, x)
 	}
-	for _, x := range envs {
-		if x == "local" {
-			debugLog("got local env, not creating roles and policies", false)
-			continue
+	if !c.policyLockProdClaims {
+		log.Printf("WARN: -policy-lock-prod-claims is deprecated, set protected: [] in %s instead", rolesFile)
+		if rconfig == nil {
+			rconfig = &RolesConfig{}
 		}
-		debugLog(fmt.Sprintf("Running genPolicy for env: %s", x), false)
-		destPolicyFile := policyFolder + "/" + c.appName + "-" + x + ".hcl"
-		destRoleFile := roleFolder + "/" + c.appName + "-" + x + ".json"
-		err := genPolicy(destPolicyFile, c.vhFolder, c.apps, x)
-		if err != nil {
-			return err
+		if rconfig.Protected == nil {
+			rconfig.Protected = []ProtectedEnv{}
 		}
-		prod := false
-		if x == "prod" || x == "qa" {
-			prod = true
+	}
+
+	for _, u := range units {
+		debugLog(fmt.Sprintf("Running genPolicy for %s (env: %s)", u.Name, u.Env), false)
+		var tmpl RoleTemplate
+		if containsString(roleTypes, "jwt") {
+			if u.ProjectID == "" {
+				return fmt.Errorf("no project_id for %s - set project_id in its map or %s", strings.Join(u.Apps, ", "), projectsFile)
+			}
+			tmpl, err = roleFor(rconfig, u.Env, u.Provider)
+			if err != nil {
+				return fmt.Errorf("role %s: %s", u.Name, err)
+			}
 		}
-		var policies []string
-		policies = append(policies, prefix+c.appName+"-"+x)
-		if c.dependencyApps != "" {
-			s := strings.Split(c.dependencyApps, ",")
-			for _, y := range s {
-				policies = append(policies, prefix+y+"-"+x)
+		var kroles []kubernetesRoleDef
+		if containsString(roleTypes, "kubernetes") {
+			kroles, err = kubernetesRoles(c.vhFolder, u)
+			if err != nil {
+				return err
+			}
+			if len(kroles) == 0 {
+				log.Printf("WARN: no service_accounts declared for %s, not generating a kubernetes role", u.Name)
 			}
 		}
-		err = genRole(destRoleFile, policies, prod, c.projectID, c.policyLockProdClaims)
+		destPolicyFile := policyFolder + "/" + u.File + ".hcl"
+		err = genPolicy(destPolicyFile, c.vhFolder, u.Apps, u.Env)
 		if err != nil {
 			return err
 		}
 		if c.applyConfig {
-			policyName := c.appName + "-" + x
-			err := applyPolicy(prefix+policyName, destPolicyFile, client)
+			err := applyPolicy(u.Name, destPolicyFile, client)
 			if err != nil {
 				return (err)
 			}
-			applyRole(prefix+policyName, destRoleFile, client)
+		}
+		if containsString(roleTypes, "jwt") {
+			destRoleFile := roleFolder + "/" + u.File + ".json"
+			err = genRole(destRoleFile, u.Policies, u.Provider, u.ProjectID, tmpl)
 			if err != nil {
-				return (err)
+				return err
+			}
+			if c.applyConfig {
+				err := applyRole(roleMount(c, u, "jwt"), u.Name, destRoleFile, client)
+				if err != nil {
+					return (err)
+				}
+			}
+		}
+		for _, r := range kroles {
+			destRoleFile := roleFolder + "/" + r.File + ".json"
+			err = writeRoleFile(destRoleFile, r.Role)
+			if err != nil {
+				return err
+			}
+			if c.applyConfig {
+				err := applyRole(roleMount(c, u, "kubernetes"), r.Name, destRoleFile, client)
+				if err != nil {
+					return (err)
+				}
+			}
+		}
+		if c.applyConfig && containsString(roleTypes, "kubernetes") {
+			err = deleteUnqualifiedKubernetesRole(roleMount(c, u, "kubernetes"), u.Name, client)
+			if err != nil {
+				return err
 			}
 		}
 		log.Printf("INFO: generated policies added to: %s", policyFolder)
@@ -249,28 +317,159 @@ func genAllRolesAndPolicies(c AppConfig, client *vapi.Client) error {
 	return nil
 }
 
+// every env across all apps, in the order they're found
+func policyEnvs(c AppConfig) ([]string, error) {
+	var envs []string
+	for _, x := range c.apps {
+		e, err := getEnvs(c.vhFolder + "/" + x)
+		if err != nil {
+			return nil, err
+		}
+		for _, y := range e {
+			if !containsString(envs, y) {
+				envs = append(envs, y)
+			}
+		}
+	}
+	return envs, nil
+}
+
+// policies attached to an env's role - its own policy followed by the policies of any -dependent-apps
+func envRolePolicies(c AppConfig, env string) []string {
+	policies := []string{envPolicyName(c, env)}
+	if c.dependencyApps != "" {
+		for _, y := range strings.Split(c.dependencyApps, ",") {
+			policies = append(policies, c.policyPrefix+"-"+y+"-"+env)
+		}
+	}
+	return policies
+}
+
+// name of the generated policy and role for an env, ex. vh-testycat-dev
+func envPolicyName(c AppConfig, env string) string {
+	return c.policyPrefix + "-" + c.appName + "-" + env
+}
+
 // generate individual policy file
 func genPolicy(filename string, configFolder string, apps []string, env string) error {
 
+	paths, err := envPolicyPaths(configFolder, apps, env)
+	if err != nil {
+		return err
+	}
 	f, err := os.Create(filename)
 	if err != nil {
 		return (err)
 	}
 	defer f.Close()
-	allKeys := make(KeyConfig)
-	var fullSecretConfig FullSecretConfigPaths
+	for _, p := range paths {
+		err := writePolicy(p.path, p.capabilities, f)
+		if err != nil {
+			return err
+		}
+	}
+	log.Printf("INFO: policy written to: %s", filename)
+	return nil
+}
+
+// paths the env's policy grants, covering every key and full secret path in the apps' maps and their policy options
+// each app's options only apply to the paths its own map reads, deny blocks apply to the whole policy
+func envPolicyPaths(configFolder string, apps []string, env string) ([]policyPath, error) {
+	configs, err := envPolicyConfigs(configFolder, apps, env)
+	if err != nil {
+		return nil, err
+	}
+	optioned := false
+	for _, x := range configs {
+		if x.Policy != nil {
+			optioned = true
+		}
+	}
+	if !optioned {
+		return referencedPolicyPaths(configs, false)
+	}
+	var paths []policyPath
+	var referenced []policyPath
+	var deny []string
+	created := make(map[string]bool)
+	for _, x := range configs {
+		var o PolicyOptions
+		if x.Policy != nil {
+			o = *x.Policy
+		}
+		appReferenced, err := referencedPolicyPaths([]SecretConfig{x}, false)
+		if err != nil {
+			return nil, err
+		}
+		referenced = append(referenced, appReferenced...)
+		appPaths, err := referencedPolicyPaths([]SecretConfig{x}, o.GlobFullPaths)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range o.Deny {
+			if !containsString(deny, d) {
+				deny = append(deny, d)
+			}
+		}
+		o.Deny = nil
+		appPaths, err = applyPolicyOptions(appPaths, o)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range appPaths {
+			if !created[p.path] {
+				paths = append(paths, p)
+				created[p.path] = true
+			}
+		}
+	}
+	if err := checkPolicyDeny(deny, referenced); err != nil {
+		return nil, err
+	}
+	return applyPolicyOptions(paths, PolicyOptions{Deny: deny})
+}
+
+// exact paths the env's maps read, before any policy options - what the graph links vars and policies through
+func envReferencedPaths(configFolder string, apps []string, env string) ([]policyPath, error) {
+	configs, err := envPolicyConfigs(configFolder, apps, env)
+	if err != nil {
+		return nil, err
+	}
+	return referencedPolicyPaths(configs, false)
+}
+
+// merged maps of the apps for an env, every app needs its own file for the env
+func envPolicyConfigs(configFolder string, apps []string, env string) ([]SecretConfig, error) {
+	var configs []SecretConfig
 	for _, x := range apps {
 		folder := configFolder + "/" + x
 		// checking if appFolder has desired env
 		_, err := os.Stat(folder + "/" + env + ".yaml")
-		if err == nil {
-			kdata := mergeConfig(folder, env)
-			fullSecretConfig = append(fullSecretConfig, kdata.FullSecretConfigPaths...)
-			for k, v := range kdata.KeyConfig {
-				allKeys[k] = v
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, mergeConfig(folder, env))
+	}
+	return configs, nil
+}
+
+// paths read by every key and full secret path in the maps, keys in name order followed by full secret paths in path order
+// glob writes non recursive full secret paths as globs, see glob_full_paths
+func referencedPolicyPaths(configs []SecretConfig, glob bool) ([]policyPath, error) {
+	var paths []policyPath
+	allKeys := make(KeyConfig)
+	var fullSecretConfig FullSecretConfigPaths
+	for _, kdata := range configs {
+		fullSecretConfig = append(fullSecretConfig, kdata.FullSecretConfigPaths...)
+		for k, v := range kdata.KeyConfig {
+			allKeys[k] = v
+		}
+		// keys of the additional secrets are namespaced by secret name as key names may repeat across secrets
+		for _, s := range kdata.Secrets {
+			fullSecretConfig = append(fullSecretConfig, s.FullSecretConfigPaths...)
+			for k, v := range s.KeyConfig {
+				allKeys[s.Name+"/"+k] = v
 			}
-		} else {
-			return err
 		}
 	}
 
@@ -280,50 +479,82 @@ func genPolicy(filename string, configFolder string, apps []string, env string)
 		keys = append(keys, key)
 	}
 	sort.Strings(keys)
-	sort.Strings(fullSecretConfig)
+	sort.Slice(fullSecretConfig, func(i, j int) bool {
+		return fullSecretConfig[i].Path < fullSecretConfig[j].Path
+	})
 	createdPaths := make(map[string]bool)
 	for _, v := range keys {
 		k := allKeys[v]
-		realPath := modSecretPath(k.Path)
-		if !createdPaths[realPath] {
-			err := writePolicy(realPath, f)
-			if err != nil {
-				return err
+		err := validateTransforms(k.Transform)
+		if err != nil {
+			return nil, fmt.Errorf("invalid transform for key %s: %s", v, err)
+		}
+		for _, p := range keyDefPaths(k) {
+			realPath := modSecretPath(p)
+			if !createdPaths[realPath] {
+				paths = append(paths, policyPath{path: realPath, capabilities: readCapabilities})
+				createdPaths[realPath] = true
 			}
-			createdPaths[realPath] = true
 		}
-
 	}
 	for _, v := range fullSecretConfig {
-		realPath := modSecretPath(v)
-		if !createdPaths[realPath] {
-			err := writePolicy(realPath, f)
-			if err != nil {
-				return err
+		for _, p := range fullSecretPolicyPaths(v) {
+			if glob && !v.Recursive {
+				p = globFullSecretPath(p)
+			}
+			if !createdPaths[p.path] {
+				paths = append(paths, p)
+				createdPaths[p.path] = true
 			}
-			createdPaths[realPath] = true
 		}
+	}
+	return paths, nil
+}
 
+// all vault paths read when resolving a key, including the paths of any inputs composed into it
+func keyDefPaths(k KeyDef) (paths []string) {
+	if k.Path != "" {
+		paths = append(paths, k.Path)
 	}
-	log.Printf("INFO: policy written to: %s", filename)
-	return nil
+	inputs := make([]string, 0, len(k.Inputs))
+	for x := range k.Inputs {
+		inputs = append(inputs, x)
+	}
+	sort.Strings(inputs)
+	for _, x := range inputs {
+		paths = append(paths, keyDefPaths(k.Inputs[x])...)
+	}
+	return paths
 }
 
-// writes a read policy entry in file for path given
-func writePolicy(path string, file *os.File) error {
-	// replace any unresolved env vars with "+" in policy
-	re := regexp.MustCompile(`[^/]+ENV_VAR_NOT_FOUND`)
-	submatchAll := re.FindAllString(path, -1)
-	for _, x := range submatchAll {
-		path = strings.ReplaceAll(path, x, "+")
+// policy paths needed to read a full secret path, recursive paths need to list the metadata tree and read everything below it
+func fullSecretPolicyPaths(v FullSecretPath) []policyPath {
+	if !v.Recursive {
+		return []policyPath{{path: modSecretPath(v.Path), capabilities: readCapabilities}}
+	}
+	p := strings.TrimSuffix(v.Path, "/")
+	return []policyPath{
+		{path: modMetadataPath(p) + "/*", capabilities: listCapabilities},
+		{path: modSecretPath(p) + "/*", capabilities: readCapabilities},
+	}
+}
+
+// writes a policy entry in file for path given
+func writePolicy(path string, capabilities []string, file *os.File) error {
+	written := writtenPolicyPath(path)
+	if written != path {
+		path = written
+		log.Printf("WARN: unresolved segments of %s are written as +, which grants access for any value in their place", path)
 	}
 	object := hclwrite.NewEmptyFile()
 	rootBody := object.Body()
 	objectBlock := rootBody.AppendNewBlock("path", []string{path})
 	objectBody := objectBlock.Body()
 
-	val := cty.StringVal("read")
-	vals := []cty.Value{val}
+	var vals []cty.Value
+	for _, x := range capabilities {
+		vals = append(vals, cty.StringVal(x))
+	}
 	objectBody.SetAttributeValue("capabilities", cty.ListVal(vals))
 	rootBody.AppendNewline()
 
@@ -334,23 +565,43 @@ func writePolicy(path string, file *os.File) error {
 	return nil
 }
 
-// generate individual role file
-func genRole(filename string, policies []string, prod bool, projectID string, lockProdClaims bool) error {
-	var b BoundClaims
-	if prod && lockProdClaims {
-		b.RefType = "branch"
-		b.Ref = "master"
-	}
-	b.ProjectID = projectID
+// path as written to a policy, any unresolved env var segments are replaced with "+"
+func writtenPolicyPath(path string) string {
+	re := regexp.MustCompile(`[^/]+ENV_VAR_NOT_FOUND`)
+	return re.ReplaceAllString(path, "+")
+}
 
-	role := VaultRole{
-		RoleType:            "jwt",
-		Policies:            policies,
-		TokenExplicitMaxTTL: 60,
-		UserClaim:           "user_email",
-		BoundClaimsType:     "glob",
-		BoundClaims:         b,
+// generate individual role file from the env's roles.yaml template
+// projectID is the gitlab project id or github owner/repo, github roles default their audience to the owner's url like github's tokens
+func genRole(filename string, policies []string, provider string, projectID string, tmpl RoleTemplate) error {
+	if err := checkCIProvider(provider); err != nil {
+		return err
+	}
+	role, err := tmpl.role()
+	if err != nil {
+		return err
 	}
+	if provider == "github" {
+		owner := strings.SplitN(projectID, "/", 2)
+		if len(owner) != 2 || owner[0] == "" || owner[1] == "" {
+			return fmt.Errorf("github project id must be the repository, ex. my-org/my-repo - got %q", projectID)
+		}
+		if len(role.BoundAudiences) == 0 {
+			role.BoundAudiences = []string{"https://github.com/" + owner[0]}
+		}
+	}
+	role.Policies = policies
+	for _, x := range tmpl.TokenPolicies {
+		if !containsString(role.Policies, x) {
+			role.Policies = append(role.Policies, x)
+		}
+	}
+	role.BoundClaims[ciProviders[provider].projectClaim] = projectID
+	return writeRoleFile(filename, role)
+}
+
+// writes a role as indented json
+func writeRoleFile(filename string, role interface{}) error {
 	file, _ := json.MarshalIndent(role, "", " ")
 	newLine := []byte("\n")
 	file = append(file, newLine...)
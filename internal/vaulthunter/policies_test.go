@@ -107,6 +107,46 @@ func Test_genPolicy(t *testing.T) {
 			},
 			wantErr:            false,
 			wantFileComparison: "./../../mocks/policies/test-prod-policy.hcl"},
+		{
+			name: "testGenPolicyDevWithTransforms",
+			args: args{
+				filename:     "./../../mocks/test-policy-with-transforms.hcl",
+				configFolder: "./../../mocks/vh",
+				apps:         []string{"transformapp"},
+				env:          "dev",
+			},
+			wantErr:            false,
+			wantFileComparison: "./../../mocks/policies/test-dev-transform-policy.hcl"},
+		{
+			name: "testGenPolicyDevRecursive",
+			args: args{
+				filename:     "./../../mocks/test-policy-recursive.hcl",
+				configFolder: "./../../mocks/vh",
+				apps:         []string{"recursiveapp"},
+				env:          "dev",
+			},
+			wantErr:            false,
+			wantFileComparison: "./../../mocks/policies/test-dev-recursive-policy.hcl"},
+		{
+			name: "testGenPolicyDevMultipleSecrets",
+			args: args{
+				filename:     "./../../mocks/test-policy-multi.hcl",
+				configFolder: "./../../mocks/vh",
+				apps:         []string{"multiapp"},
+				env:          "dev",
+			},
+			wantErr:            false,
+			wantFileComparison: "./../../mocks/policies/test-dev-multi-policy.hcl"},
+		{
+			name: "testGenPolicyDevOptions",
+			args: args{
+				filename:     "./../../mocks/test-policy-options.hcl",
+				configFolder: "./../../mocks/vh",
+				apps:         []string{"optionsapp"},
+				env:          "dev",
+			},
+			wantErr:            false,
+			wantFileComparison: "./../../mocks/policies/test-dev-options-policy.hcl"},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -139,12 +179,13 @@ func Test_genPolicy(t *testing.T) {
 
 func Test_genRole(t *testing.T) {
 	type args struct {
-		filename       string
-		policies       []string
-		prod           bool
-		projectID      string
-		lockProdClaims bool
+		filename  string
+		policies  []string
+		provider  string
+		projectID string
+		tmpl      RoleTemplate
 	}
+	refProtected := true
 	tests := []struct {
 		name               string
 		args               args
@@ -154,11 +195,11 @@ func Test_genRole(t *testing.T) {
 		{
 			name: "genRoleTestDev",
 			args: args{
-				filename:       "./../../mocks/dev-role.json",
-				policies:       []string{"vh-test-dev"},
-				prod:           false,
-				projectID:      "15",
-				lockProdClaims: true,
+				filename:  "./../../mocks/dev-role.json",
+				policies:  []string{"vh-test-dev"},
+				provider:  "gitlab",
+				projectID: "15",
+				tmpl:      defaultRoleTemplate("gitlab"),
 			},
 			wantErr:            false,
 			wantFileComparison: "./../../mocks/roles/test-dev-role.json",
@@ -166,11 +207,11 @@ func Test_genRole(t *testing.T) {
 		{
 			name: "genRoleTestProd",
 			args: args{
-				filename:       "./../../mocks/prod-role.json",
-				policies:       []string{"vh-test-prod"},
-				prod:           true,
-				projectID:      "15",
-				lockProdClaims: true,
+				filename:  "./../../mocks/prod-role.json",
+				policies:  []string{"vh-test-prod"},
+				provider:  "gitlab",
+				projectID: "15",
+				tmpl:      mergeRoleTemplates(defaultRoleTemplate("gitlab"), RoleTemplate{BoundClaims: map[string]interface{}{"ref": "master", "ref_type": "branch"}}),
 			},
 			wantErr:            false,
 			wantFileComparison: "./../../mocks/roles/test-prod-role.json",
@@ -178,19 +219,57 @@ func Test_genRole(t *testing.T) {
 		{
 			name: "genRoleTestProdNoLock",
 			args: args{
-				filename:       "./../../mocks/prod-role-no-lock.json",
-				policies:       []string{"vh-test-prod"},
-				prod:           true,
-				projectID:      "15",
-				lockProdClaims: false,
+				filename:  "./../../mocks/prod-role-no-lock.json",
+				policies:  []string{"vh-test-prod"},
+				provider:  "gitlab",
+				projectID: "15",
+				tmpl:      defaultRoleTemplate("gitlab"),
 			},
 			wantErr:            false,
 			wantFileComparison: "./../../mocks/roles/test-prod-role-no-lock.json",
 		},
+		{
+			name: "genRoleTestProdTemplate",
+			args: args{
+				filename:  "./../../mocks/prod-role-template.json",
+				policies:  []string{"vh-test-prod"},
+				provider:  "gitlab",
+				projectID: "15",
+				tmpl: RoleTemplate{
+					TokenTTL:            "15m",
+					TokenMaxTTL:         "3600",
+					TokenExplicitMaxTTL: "1h",
+					UserClaim:           "user_login",
+					BoundClaimsType:     "string",
+					BoundAudiences:      []string{"https://vault.example.com"},
+					NamespacePath:       "testycat",
+					Environment:         "production",
+					RefProtected:        &refProtected,
+					BoundClaims:         map[string]interface{}{"ref": []interface{}{"main", "release"}},
+					ClaimMappings:       map[string]string{"project_path": "project"},
+					TokenBoundCIDRs:     []string{"10.0.0.0/8", "192.168.1.1"},
+					TokenPolicies:       []string{"vh-audit"},
+				},
+			},
+			wantErr:            false,
+			wantFileComparison: "./../../mocks/roles/test-prod-role-template.json",
+		},
+		{
+			name: "genRoleTestGithubProd",
+			args: args{
+				filename:  "./../../mocks/prod-role-github.json",
+				policies:  []string{"vh-test-prod"},
+				provider:  "github",
+				projectID: "testycat/test",
+				tmpl:      mergeRoleTemplates(defaultRoleTemplate("github"), RoleTemplate{Environment: "production", BoundClaims: map[string]interface{}{"ref": "refs/heads/main", "job_workflow_ref": "testycat/workflows/.github/workflows/deploy.yml@refs/heads/main"}}),
+			},
+			wantErr:            false,
+			wantFileComparison: "./../../mocks/roles/test-prod-role-github.json",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if err := genRole(tt.args.filename, tt.args.policies, tt.args.prod, tt.args.projectID, tt.args.lockProdClaims); (err != nil) != tt.wantErr {
+			if err := genRole(tt.args.filename, tt.args.policies, tt.args.provider, tt.args.projectID, tt.args.tmpl); (err != nil) != tt.wantErr {
 				t.Errorf("genRole() error = %v, wantErr %v", err, tt.wantErr)
 			}
 			f1, err1 := ioutil.ReadFile(tt.args.filename)
@@ -215,3 +294,60 @@ func Test_genRole(t *testing.T) {
 		})
 	}
 }
+
+func Test_keyDefPaths(t *testing.T) {
+	tests := []struct {
+		name      string
+		k         KeyDef
+		wantPaths []string
+	}{
+		{name: "keyDefPathsTest", k: KeyDef{Path: "secret/one", Key: "key"}, wantPaths: []string{"secret/one"}},
+		{
+			name: "keyDefPathsInputsTest",
+			k: KeyDef{
+				Inputs: map[string]KeyDef{
+					"user": {Path: "secret/db", Key: "username"},
+					"host": {Path: "config/db", Key: "host"},
+				},
+				Transform: Transforms{{Name: "template", Arg: `{{ input "user" }}@{{ input "host" }}`}},
+			},
+			wantPaths: []string{"config/db", "secret/db"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if gotPaths := keyDefPaths(tt.k); !reflect.DeepEqual(gotPaths, tt.wantPaths) {
+				t.Errorf("keyDefPaths() = %v, want %v", gotPaths, tt.wantPaths)
+			}
+		})
+	}
+}
+
+func Test_fullSecretPolicyPaths(t *testing.T) {
+	tests := []struct {
+		name string
+		v    FullSecretPath
+		want []policyPath
+	}{
+		{
+			name: "fullSecretPolicyPathsTest",
+			v:    FullSecretPath{Path: "config/app-three/dev"},
+			want: []policyPath{{path: "config/data/app-three/dev", capabilities: []string{"read"}}},
+		},
+		{
+			name: "fullSecretPolicyPathsRecursiveTest",
+			v:    FullSecretPath{Path: "config/app-three/dev/", Recursive: true},
+			want: []policyPath{
+				{path: "config/metadata/app-three/dev/*", capabilities: []string{"list"}},
+				{path: "config/data/app-three/dev/*", capabilities: []string{"read"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fullSecretPolicyPaths(tt.v); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("fullSecretPolicyPaths() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package vaulthunter
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+)
+
+// map-level control of the policy generated for an env, set with policy: in a map
+type PolicyOptions struct {
+	ListMetadata      bool     `yaml:"list_metadata,omitempty"`
+	GlobFullPaths     bool     `yaml:"glob_full_paths,omitempty"`
+	Deny              []string `yaml:"deny,omitempty"`
+	CollapseThreshold int      `yaml:"collapse_threshold,omitempty"`
+}
+
+var denyCapabilities = []string{"deny"}
+
+func (o PolicyOptions) validate() error {
+	if o.CollapseThreshold < 0 || o.CollapseThreshold == 1 {
+		return fmt.Errorf("policy collapse_threshold must be at least 2, got %d", o.CollapseThreshold)
+	}
+	for _, x := range o.Deny {
+		if strings.Trim(x, "/") == "" {
+			return fmt.Errorf("policy deny entries must be a secret path")
+		}
+	}
+	return nil
+}
+
+// policy path reading a full secret path and everything starting with it, ex. secret/data/app/dev*
+func globFullSecretPath(p policyPath) policyPath {
+	glob := policyPath{path: p.path + "*", capabilities: p.capabilities}
+	log.Printf("WARN: %s is written as %s, which also grants %s on every secret path starting with it", p.path, glob.path, strings.Join(p.capabilities, ","))
+	return glob
+}
+
+// applies collapsing, metadata listing and deny options to the paths an app's map references
+func applyPolicyOptions(paths []policyPath, o PolicyOptions) ([]policyPath, error) {
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+	if err := checkPolicyDeny(o.Deny, paths); err != nil {
+		return nil, err
+	}
+	if o.CollapseThreshold > 0 {
+		paths = collapsePolicyPaths(paths, o.CollapseThreshold)
+	}
+	created := make(map[string]bool)
+	for _, p := range paths {
+		created[p.path] = true
+	}
+	if o.ListMetadata {
+		for _, p := range paths {
+			if !reflect.DeepEqual(p.capabilities, readCapabilities) {
+				continue
+			}
+			parent := p.path[:strings.LastIndex(p.path, "/")]
+			// listing a mount's root shows every secret in it
+			if len(strings.Split(parent, "/")) <= 2 {
+				log.Printf("WARN: not listing metadata for %s, its parent is the root of the %s mount", p.path, strings.Split(parent, "/")[0])
+				continue
+			}
+			m := dataToMetadataPath(parent)
+			if !created[m] {
+				paths = append(paths, policyPath{path: m, capabilities: listCapabilities})
+				created[m] = true
+			}
+		}
+	}
+	for _, x := range o.Deny {
+		data := modSecretPath(strings.Trim(x, "/"))
+		for _, d := range []string{data, dataToMetadataPath(data)} {
+			if !created[d] {
+				paths = append(paths, policyPath{path: d, capabilities: denyCapabilities})
+				created[d] = true
+			}
+		}
+	}
+	return paths, nil
+}
+
+// errors when a deny path covers a path the maps read, globs and unresolved segments are skipped
+func checkPolicyDeny(deny []string, paths []policyPath) error {
+	for _, x := range deny {
+		for _, p := range paths {
+			if !isPolicyGlob(p.path) && policyPathMatches(modSecretPath(strings.Trim(x, "/")), p.path) {
+				return fmt.Errorf("policy deny %s covers %s, which the maps read", x, p.path)
+			}
+		}
+	}
+	return nil
+}
+
+// replaces threshold or more exact read paths sharing a parent with a parent/* glob, kept at the first path's position
+func collapsePolicyPaths(paths []policyPath, threshold int) []policyPath {
+	siblings := make(map[string][]string)
+	for _, p := range paths {
+		if isPolicyGlob(p.path) || !reflect.DeepEqual(p.capabilities, readCapabilities) {
+			continue
+		}
+		parent := p.path[:strings.LastIndex(p.path, "/")]
+		siblings[parent] = append(siblings[parent], p.path)
+	}
+	var collapsed []policyPath
+	created := make(map[string]bool)
+	for _, p := range paths {
+		path := p.path
+		if !isPolicyGlob(path) && reflect.DeepEqual(p.capabilities, readCapabilities) {
+			parent := path[:strings.LastIndex(path, "/")]
+			if n := len(siblings[parent]); n >= threshold {
+				path = parent + "/*"
+				if !created[path] {
+					log.Printf("WARN: collapsed %d paths under %s into %s, which also grants read on every secret below it: %s", n, parent, path, strings.Join(siblings[parent], ", "))
+				}
+			}
+		}
+		if !created[path] {
+			collapsed = append(collapsed, policyPath{path: path, capabilities: p.capabilities})
+			created[path] = true
+		}
+	}
+	return collapsed
+}
+
+// converts a kv v2 data path to its metadata path, ex. secret/data/app -> secret/metadata/app
+func dataToMetadataPath(p string) string {
+	return strings.Replace(p, "/data", "/metadata", 1)
+}
+
+// globs and unresolved segments, which are written as +
+func isPolicyGlob(p string) bool {
+	return strings.HasSuffix(p, "*") || strings.Contains(p, "+") || strings.Contains(p, "ENV_VAR_NOT_FOUND")
+}
+
+// matches path against a vault policy path, + matching a single segment and a trailing * any suffix
+func policyPathMatches(pattern string, path string) bool {
+	prefix := strings.HasSuffix(pattern, "*")
+	patternSegments := strings.Split(strings.TrimSuffix(pattern, "*"), "/")
+	pathSegments := strings.Split(path, "/")
+	if len(pathSegments) < len(patternSegments) || (!prefix && len(pathSegments) != len(patternSegments)) {
+		return false
+	}
+	for i, x := range patternSegments {
+		switch {
+		case x == "+":
+		case prefix && i == len(patternSegments)-1:
+			if !strings.HasPrefix(pathSegments[i], x) {
+				return false
+			}
+		case x != pathSegments[i]:
+			return false
+		}
+	}
+	return true
+}
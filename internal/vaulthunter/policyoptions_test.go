@@ -0,0 +1,185 @@
+package vaulthunter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_envPolicyPaths(t *testing.T) {
+	type args struct {
+		apps []string
+		env  string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    []policyPath
+		wantErr bool
+	}{
+		{
+			name: "envPolicyPathsCombinedOptionsTest",
+			args: args{apps: []string{"optionsapp", "fullsecretapp", "seedapp"}, env: "dev"},
+			// fullsecretapp and seedapp set no options, so their four sibling paths are neither collapsed nor listed
+			want: []policyPath{
+				{path: "secret/data/optionsapp/dev/*", capabilities: readCapabilities},
+				{path: "secret/data/shared/dev/token", capabilities: readCapabilities},
+				{path: "config/data/optionsapp/dev*", capabilities: readCapabilities},
+				{path: "secret/metadata/optionsapp/dev", capabilities: listCapabilities},
+				{path: "secret/metadata/shared/dev", capabilities: listCapabilities},
+				{path: "config/metadata/optionsapp", capabilities: listCapabilities},
+				{path: "secret/data/location/one/config/app-two-client-dev", capabilities: readCapabilities},
+				{path: "secret/data/location/one/config/fullsecret", capabilities: readCapabilities},
+				{path: "secret/data/location/one/config/seed-api", capabilities: readCapabilities},
+				{path: "secret/data/location/one/config/seed", capabilities: readCapabilities},
+				{path: "secret/data/optionsapp/dev/root/*", capabilities: denyCapabilities},
+				{path: "secret/metadata/optionsapp/dev/root/*", capabilities: denyCapabilities},
+			},
+		},
+		{
+			name: "envPolicyPathsNoOptionsTest",
+			args: args{apps: []string{"fullsecretapp"}, env: "dev"},
+			want: []policyPath{
+				{path: "secret/data/location/one/config/app-two-client-dev", capabilities: readCapabilities},
+				{path: "secret/data/location/one/config/fullsecret", capabilities: readCapabilities},
+			},
+		},
+		{
+			name:    "envPolicyPathsMissingEnvTest",
+			args:    args{apps: []string{"optionsapp"}, env: "prod"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := envPolicyPaths("./../../mocks/vh", tt.args.apps, tt.args.env)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("envPolicyPaths() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("envPolicyPaths() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_applyPolicyOptions(t *testing.T) {
+	type args struct {
+		paths []policyPath
+		o     PolicyOptions
+	}
+	siblings := []policyPath{
+		{path: "secret/data/app/dev/a", capabilities: readCapabilities},
+		{path: "secret/data/other/b", capabilities: readCapabilities},
+		{path: "secret/data/app/dev/c", capabilities: readCapabilities},
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    []policyPath
+		wantErr bool
+	}{
+		{
+			name: "applyPolicyOptionsNoneTest",
+			args: args{paths: siblings},
+			want: siblings,
+		},
+		{
+			name: "applyPolicyOptionsCollapseTest",
+			args: args{paths: siblings, o: PolicyOptions{CollapseThreshold: 2}},
+			want: []policyPath{
+				{path: "secret/data/app/dev/*", capabilities: readCapabilities},
+				{path: "secret/data/other/b", capabilities: readCapabilities},
+			},
+		},
+		{
+			name: "applyPolicyOptionsBelowThresholdTest",
+			args: args{paths: siblings, o: PolicyOptions{CollapseThreshold: 3}},
+			want: siblings,
+		},
+		{
+			name: "applyPolicyOptionsListMetadataTest",
+			args: args{
+				paths: []policyPath{
+					{path: "secret/data/app/dev/a", capabilities: readCapabilities},
+					{path: "config/metadata/app/dev/*", capabilities: listCapabilities},
+					{path: "config/data/app/dev/*", capabilities: readCapabilities},
+				},
+				o: PolicyOptions{ListMetadata: true},
+			},
+			want: []policyPath{
+				{path: "secret/data/app/dev/a", capabilities: readCapabilities},
+				{path: "config/metadata/app/dev/*", capabilities: listCapabilities},
+				{path: "config/data/app/dev/*", capabilities: readCapabilities},
+				{path: "secret/metadata/app/dev", capabilities: listCapabilities},
+				{path: "config/metadata/app/dev", capabilities: listCapabilities},
+			},
+		},
+		{
+			name: "applyPolicyOptionsListMetadataMountRootTest",
+			args: args{
+				paths: []policyPath{{path: "secret/data/app", capabilities: readCapabilities}},
+				o:     PolicyOptions{ListMetadata: true},
+			},
+			want: []policyPath{{path: "secret/data/app", capabilities: readCapabilities}},
+		},
+		{
+			name: "applyPolicyOptionsDenyTest",
+			args: args{paths: siblings[:1], o: PolicyOptions{Deny: []string{"secret/app/dev/root/"}}},
+			want: []policyPath{
+				{path: "secret/data/app/dev/a", capabilities: readCapabilities},
+				{path: "secret/data/app/dev/root", capabilities: denyCapabilities},
+				{path: "secret/metadata/app/dev/root", capabilities: denyCapabilities},
+			},
+		},
+		{
+			name:    "applyPolicyOptionsDenyReferencedTest",
+			args:    args{paths: siblings, o: PolicyOptions{Deny: []string{"secret/app/+/a"}, CollapseThreshold: 2}},
+			wantErr: true,
+		},
+		{
+			name:    "applyPolicyOptionsInvalidThresholdTest",
+			args:    args{paths: siblings, o: PolicyOptions{CollapseThreshold: 1}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyPolicyOptions(tt.args.paths, tt.args.o)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("applyPolicyOptions() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("applyPolicyOptions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_policyPathMatches(t *testing.T) {
+	type args struct {
+		pattern string
+		path    string
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{name: "policyPathMatchesExactTest", args: args{pattern: "secret/data/app", path: "secret/data/app"}, want: true},
+		{name: "policyPathMatchesExactMissTest", args: args{pattern: "secret/data/app", path: "secret/data/app/dev"}, want: false},
+		{name: "policyPathMatchesGlobTest", args: args{pattern: "secret/data/app/*", path: "secret/data/app/dev/db"}, want: true},
+		{name: "policyPathMatchesGlobParentTest", args: args{pattern: "secret/data/app/*", path: "secret/data/app"}, want: false},
+		{name: "policyPathMatchesSuffixGlobTest", args: args{pattern: "secret/data/app/dev*", path: "secret/data/app/dev-old"}, want: true},
+		{name: "policyPathMatchesSegmentTest", args: args{pattern: "secret/data/+/dev", path: "secret/data/app/dev"}, want: true},
+		{name: "policyPathMatchesSegmentMissTest", args: args{pattern: "secret/data/+/dev", path: "secret/data/app/prod"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policyPathMatches(tt.args.pattern, tt.args.path); got != tt.want {
+				t.Errorf("policyPathMatches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
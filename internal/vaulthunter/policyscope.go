@@ -0,0 +1,125 @@
+package vaulthunter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+// file within the vh folder mapping app folders to their gitlab project ids
+const projectsFile = "projects.yaml"
+
+// a generated policy and its role - one per env covering every app in combined scope, or one per app and env in per-app scope
+// file is the generated file name without extension, policies are attached to the role
+// project id is the gitlab project id or github owner/repo of the provider the role accepts jwts from
+// jwt mount is set when the app's map picks the auth mount its jwt role is written to
+type policyUnit struct {
+	Name      string
+	File      string
+	Env       string
+	Apps      []string
+	Provider  string
+	ProjectID string
+	JWTMount  string
+	Policies  []string
+}
+
+// reads vh/projects.yaml, a missing file is not an error
+func parseProjects(vhFolder string) (map[string]string, error) {
+	file := filepath.Join(vhFolder, projectsFile)
+	if !fileExists(file) {
+		return nil, nil
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read projects file: %s", err)
+	}
+	var projects map[string]string
+	err = yaml.Unmarshal(b, &projects)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse projects file %s: %s", file, err)
+	}
+	return projects, nil
+}
+
+// name of the generated policy and role granting an app's env
+func scopedPolicyName(c AppConfig, app string, env string) string {
+	if c.policyScope == "per-app" {
+		return c.policyPrefix + "-" + app + "-" + env
+	}
+	return envPolicyName(c, env)
+}
+
+// every policy and role generate-policies creates, local envs get none
+// per-app units take their project id from the map's project_id, then vh/projects.yaml - it's left empty when neither sets one
+// and their provider and jwt mount from the map's ci_provider and jwt_mount, then -ci-provider and -jwt-mount
+func policyUnits(c AppConfig) ([]policyUnit, error) {
+	var units []policyUnit
+	provider := c.ciProvider
+	if provider == "" {
+		provider = "gitlab"
+	}
+	switch c.policyScope {
+	case "", "combined":
+		envs, err := policyEnvs(c)
+		if err != nil {
+			return nil, err
+		}
+		for _, env := range envs {
+			if env == "local" {
+				continue
+			}
+			units = append(units, policyUnit{
+				Name:      envPolicyName(c, env),
+				File:      c.appName + "-" + env,
+				Env:       env,
+				Apps:      c.apps,
+				Provider:  provider,
+				ProjectID: c.projectID,
+				Policies:  envRolePolicies(c, env),
+			})
+		}
+	case "per-app":
+		projects, err := parseProjects(c.vhFolder)
+		if err != nil {
+			return nil, err
+		}
+		for _, app := range c.apps {
+			folder := c.vhFolder + "/" + app
+			envs, err := getEnvs(folder)
+			if err != nil {
+				return nil, err
+			}
+			for _, env := range envs {
+				if env == "local" {
+					continue
+				}
+				data := mergeConfig(folder, env)
+				projectID := data.ProjectID
+				if projectID == "" {
+					projectID = projects[app]
+				}
+				appProvider := provider
+				if data.CIProvider != "" {
+					appProvider = data.CIProvider
+				}
+				name := scopedPolicyName(c, app, env)
+				units = append(units, policyUnit{
+					Name:      name,
+					File:      app + "-" + env,
+					Env:       env,
+					Apps:      []string{app},
+					Provider:  appProvider,
+					ProjectID: projectID,
+					JWTMount:  data.JWTMount,
+					Policies:  append([]string{name}, envRolePolicies(c, env)[1:]...),
+				})
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown policy scope: %s - must be per-app or combined", c.policyScope)
+	}
+	return units, nil
+}
@@ -0,0 +1,119 @@
+package vaulthunter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_parseProjects(t *testing.T) {
+	type args struct {
+		vhFolder string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "testParseProjects",
+			args: args{vhFolder: "./../../mocks/vh"},
+			want: map[string]string{"rotateapp": "62", "multiapp": "63"},
+		},
+		{
+			name: "testParseProjectsMissingFile",
+			args: args{vhFolder: "./../../mocks/vh/rotateapp"},
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseProjects(tt.args.vhFolder)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseProjects() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseProjects() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_scopedPolicyName(t *testing.T) {
+	type args struct {
+		c   AppConfig
+		app string
+		env string
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{
+			name: "testScopedPolicyNameCombined",
+			args: args{c: AppConfig{policyPrefix: "vh", appName: "testycat", policyScope: "combined"}, app: "rotateapp", env: "dev"},
+			want: "vh-testycat-dev",
+		},
+		{
+			name: "testScopedPolicyNamePerApp",
+			args: args{c: AppConfig{policyPrefix: "vh", appName: "testycat", policyScope: "per-app"}, app: "rotateapp", env: "dev"},
+			want: "vh-rotateapp-dev",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scopedPolicyName(tt.args.c, tt.args.app, tt.args.env); got != tt.want {
+				t.Errorf("scopedPolicyName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_policyUnits(t *testing.T) {
+	type args struct {
+		c AppConfig
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    []policyUnit
+		wantErr bool
+	}{
+		{
+			name: "testPolicyUnitsCombined",
+			args: args{c: AppConfig{vhFolder: "./../../mocks/vh", apps: []string{"rotateapp"}, policyPrefix: "vh", appName: "testycat", projectID: "60", dependencyApps: "shared"}},
+			want: []policyUnit{
+				{Name: "vh-testycat-dev", File: "testycat-dev", Env: "dev", Apps: []string{"rotateapp"}, Provider: "gitlab", ProjectID: "60", Policies: []string{"vh-testycat-dev", "vh-shared-dev"}},
+				{Name: "vh-testycat-prod", File: "testycat-prod", Env: "prod", Apps: []string{"rotateapp"}, Provider: "gitlab", ProjectID: "60", Policies: []string{"vh-testycat-prod", "vh-shared-prod"}},
+			},
+		},
+		{
+			name: "testPolicyUnitsPerApp",
+			args: args{c: AppConfig{vhFolder: "./../../mocks/vh", apps: []string{"rotateapp", "seedapp"}, policyPrefix: "vh", dependencyApps: "shared", policyScope: "per-app"}},
+			want: []policyUnit{
+				{Name: "vh-rotateapp-dev", File: "rotateapp-dev", Env: "dev", Apps: []string{"rotateapp"}, Provider: "gitlab", ProjectID: "62", Policies: []string{"vh-rotateapp-dev", "vh-shared-dev"}},
+				{Name: "vh-rotateapp-prod", File: "rotateapp-prod", Env: "prod", Apps: []string{"rotateapp"}, Provider: "gitlab", ProjectID: "61", Policies: []string{"vh-rotateapp-prod", "vh-shared-prod"}},
+				{Name: "vh-seedapp-dev", File: "seedapp-dev", Env: "dev", Apps: []string{"seedapp"}, Provider: "github", ProjectID: "testycat/seedapp", Policies: []string{"vh-seedapp-dev", "vh-shared-dev"}},
+			},
+		},
+		{
+			name:    "testPolicyUnitsUnknownScope",
+			args:    args{c: AppConfig{vhFolder: "./../../mocks/vh", apps: []string{"rotateapp"}, policyScope: "per-env"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := policyUnits(tt.args.c)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("policyUnits() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("policyUnits() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package vaulthunter
+
+import (
+	"sort"
+	"strings"
+)
+
+// a map key reading a vault path and key
+// var is the env var/secret key the value ends up in, policy and role are the generated ones granting it
+type secretReference struct {
+	App    string `json:"app"`
+	Env    string `json:"env"`
+	Secret string `json:"secret"`
+	Var    string `json:"var"`
+	Path   string `json:"path"`
+	Key    string `json:"key,omitempty"`
+	Policy string `json:"policy,omitempty"`
+	Role   string `json:"role,omitempty"`
+}
+
+// every app/env map key reading the vault path and key, an empty key matches every key at the path
+// only envs an app has its own file for are searched, like generate-policies, and only c.configEnv when set
+func findReferences(c AppConfig, p string, key string) ([]secretReference, error) {
+	p = strings.Trim(p, "/")
+	var refs []secretReference
+	for _, app := range c.apps {
+		folder := c.vhFolder + "/" + app
+		envs, err := getEnvs(folder)
+		if err != nil {
+			return nil, err
+		}
+		for _, env := range envs {
+			if c.configEnv != "" && env != c.configEnv {
+				continue
+			}
+			data := mergeConfig(folder, env)
+			defs, err := data.secretDefs()
+			if err != nil {
+				return nil, err
+			}
+			for _, d := range defs {
+				for _, r := range secretDefReferences(d, p, key) {
+					r.App = app
+					r.Env = env
+					refs = append(refs, r)
+				}
+			}
+		}
+	}
+	return refs, nil
+}
+
+// references to the vault path and key within a single secret
+func secretDefReferences(d SecretDef, p string, key string) []secretReference {
+	var refs []secretReference
+	names := make([]string, 0, len(d.KeyConfig))
+	for k := range d.KeyConfig {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, k := range keyDefReferences(d.KeyConfig[name], p, key) {
+			refs = append(refs, secretReference{Secret: d.Name, Var: name, Path: p, Key: k})
+		}
+	}
+	for _, x := range d.FullSecretConfigPaths {
+		entry := x
+		entryPath := strings.Trim(x.Path, "/")
+		if entryPath != p {
+			// recursive entries read every secret below their path
+			if !x.Recursive || !strings.HasPrefix(p, entryPath+"/") {
+				continue
+			}
+			leaf := strings.TrimPrefix(p, entryPath+"/")
+			if x.PathPrefix {
+				entry.Prefix = x.Prefix + pathKeyPrefix(leaf)
+			}
+		}
+		if key == "" {
+			refs = append(refs, secretReference{Secret: d.Name, Var: entry.Prefix + "*", Path: p})
+			continue
+		}
+		name, ok, err := fullSecretKeyName(entry, key)
+		if err != nil || !ok {
+			continue
+		}
+		refs = append(refs, secretReference{Secret: d.Name, Var: name, Path: p, Key: key})
+	}
+	return refs
+}
+
+// keys at the vault path a key_config entry, or any of its inputs, reads
+func keyDefReferences(v KeyDef, p string, key string) []string {
+	var keys []string
+	if v.Path != "" && strings.Trim(v.Path, "/") == p && (key == "" || v.Key == key) {
+		keys = append(keys, v.Key)
+	}
+	inputs := make([]string, 0, len(v.Inputs))
+	for x := range v.Inputs {
+		inputs = append(inputs, x)
+	}
+	sort.Strings(inputs)
+	for _, x := range inputs {
+		keys = append(keys, keyDefReferences(v.Inputs[x], p, key)...)
+	}
+	return keys
+}
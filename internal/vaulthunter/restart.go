@@ -0,0 +1,175 @@
+package vaulthunter
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	appsv1client "k8s.io/client-go/kubernetes/typed/apps/v1"
+)
+
+// secret annotation holding a hash of the secret's content, compared on update to detect changes
+const secretHashAnnotation = "vault-hunter/content-hash"
+
+// pod template annotation patched to roll workloads when a secret they use changes
+const restartedAtAnnotation = "vault-hunter/restartedAt"
+
+// sha256 of a secret's type and data, keys are sorted so the hash is stable
+func secretContentHash(secretType apiv1.SecretType, data map[string][]byte) string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	h := sha256.New()
+	h.Write([]byte(secretType))
+	for _, k := range keys {
+		h.Write([]byte{0})
+		h.Write([]byte(k))
+		h.Write([]byte{0})
+		h.Write(data[k])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// true if the pod spec uses the secret through envFrom, env, or a secret or projected volume
+func podSpecUsesSecret(spec apiv1.PodSpec, secretName string) bool {
+	for _, v := range spec.Volumes {
+		if v.Secret != nil && v.Secret.SecretName == secretName {
+			return true
+		}
+		if v.Projected != nil {
+			for _, p := range v.Projected.Sources {
+				if p.Secret != nil && p.Secret.Name == secretName {
+					return true
+				}
+			}
+		}
+	}
+	containers := append(append([]apiv1.Container{}, spec.InitContainers...), spec.Containers...)
+	for _, c := range containers {
+		for _, e := range c.EnvFrom {
+			if e.SecretRef != nil && e.SecretRef.Name == secretName {
+				return true
+			}
+		}
+		for _, e := range c.Env {
+			if e.ValueFrom != nil && e.ValueFrom.SecretKeyRef != nil && e.ValueFrom.SecretKeyRef.Name == secretName {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// patches the pod template of every deployment, statefulset and daemonset in the namespace using the secret
+// returns the restarted workloads as kind/name
+func restartWorkloads(clientset kubernetes.Interface, namespace string, secretName string) ([]string, error) {
+	ctx := context.TODO()
+	patch, err := podTemplateAnnotationPatch(map[string]string{restartedAtAnnotation: time.Now().Format(time.RFC3339)})
+	if err != nil {
+		return nil, err
+	}
+	apps := clientset.AppsV1()
+	var using []string
+
+	deployments, err := apps.Deployments(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list deployments: %s", err)
+	}
+	for _, x := range deployments.Items {
+		if podSpecUsesSecret(x.Spec.Template.Spec, secretName) {
+			using = append(using, "deployment/"+x.Name)
+		}
+	}
+	statefulSets, err := apps.StatefulSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list statefulsets: %s", err)
+	}
+	for _, x := range statefulSets.Items {
+		if podSpecUsesSecret(x.Spec.Template.Spec, secretName) {
+			using = append(using, "statefulset/"+x.Name)
+		}
+	}
+	daemonSets, err := apps.DaemonSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list daemonsets: %s", err)
+	}
+	for _, x := range daemonSets.Items {
+		if podSpecUsesSecret(x.Spec.Template.Spec, secretName) {
+			using = append(using, "daemonset/"+x.Name)
+		}
+	}
+
+	var restarted []string
+	for _, x := range using {
+		err := patchWorkload(apps, namespace, x, patch)
+		if err != nil {
+			return restarted, err
+		}
+		restarted = append(restarted, x)
+	}
+	return restarted, nil
+}
+
+// strategic merge patch setting annotations on a workload's pod template
+func podTemplateAnnotationPatch(annotations map[string]string) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": annotations,
+				},
+			},
+		},
+	})
+}
+
+// splits a workload reference, ex. deploy/app-one, into its kind and name
+// kinds can be written as kubectl does - deploy/deployment, sts/statefulset or ds/daemonset
+func parseWorkloadRef(ref string) (string, string, error) {
+	parts := strings.SplitN(ref, "/", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid workload %s - must be kind/name, ex. deploy/app-one", ref)
+	}
+	switch strings.ToLower(parts[0]) {
+	case "deploy", "deployment", "deployments":
+		return "deployment", parts[1], nil
+	case "sts", "statefulset", "statefulsets":
+		return "statefulset", parts[1], nil
+	case "ds", "daemonset", "daemonsets":
+		return "daemonset", parts[1], nil
+	}
+	return "", "", fmt.Errorf("unsupported workload kind %s - must be a deployment, statefulset or daemonset", parts[0])
+}
+
+// applies patch to a single workload given as kind/name
+func patchWorkload(apps appsv1client.AppsV1Interface, namespace string, ref string, patch []byte) error {
+	ctx := context.TODO()
+	kind, name, err := parseWorkloadRef(ref)
+	if err != nil {
+		return err
+	}
+	opts := metav1.PatchOptions{}
+	switch kind {
+	case "deployment":
+		_, err = apps.Deployments(namespace).Patch(ctx, name, types.StrategicMergePatchType, patch, opts)
+	case "statefulset":
+		_, err = apps.StatefulSets(namespace).Patch(ctx, name, types.StrategicMergePatchType, patch, opts)
+	case "daemonset":
+		_, err = apps.DaemonSets(namespace).Patch(ctx, name, types.StrategicMergePatchType, patch, opts)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to patch %s/%s: %s", kind, name, err)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package vaulthunter
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_secretContentHash(t *testing.T) {
+	base := secretContentHash(apiv1.SecretTypeOpaque, map[string][]byte{"A": []byte("1"), "B": []byte("2")})
+	tests := []struct {
+		name       string
+		secretType apiv1.SecretType
+		data       map[string][]byte
+		wantSame   bool
+	}{
+		{name: "secretContentHashSameTest", secretType: apiv1.SecretTypeOpaque, data: map[string][]byte{"B": []byte("2"), "A": []byte("1")}, wantSame: true},
+		{name: "secretContentHashValueTest", secretType: apiv1.SecretTypeOpaque, data: map[string][]byte{"A": []byte("1"), "B": []byte("3")}, wantSame: false},
+		{name: "secretContentHashKeyTest", secretType: apiv1.SecretTypeOpaque, data: map[string][]byte{"A": []byte("12")}, wantSame: false},
+		{name: "secretContentHashTypeTest", secretType: apiv1.SecretTypeDockerConfigJson, data: map[string][]byte{"A": []byte("1"), "B": []byte("2")}, wantSame: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := secretContentHash(tt.secretType, tt.data); (got == base) != tt.wantSame {
+				t.Errorf("secretContentHash() = %v, base %v, wantSame %v", got, base, tt.wantSame)
+			}
+		})
+	}
+}
+
+func Test_podSpecUsesSecret(t *testing.T) {
+	tests := []struct {
+		name string
+		spec apiv1.PodSpec
+		want bool
+	}{
+		{
+			name: "podSpecUsesSecretEnvFromTest",
+			spec: apiv1.PodSpec{Containers: []apiv1.Container{{EnvFrom: []apiv1.EnvFromSource{{SecretRef: &apiv1.SecretEnvSource{LocalObjectReference: apiv1.LocalObjectReference{Name: "app"}}}}}}},
+			want: true,
+		},
+		{
+			name: "podSpecUsesSecretEnvTest",
+			spec: apiv1.PodSpec{InitContainers: []apiv1.Container{{Env: []apiv1.EnvVar{{Name: "A", ValueFrom: &apiv1.EnvVarSource{SecretKeyRef: &apiv1.SecretKeySelector{LocalObjectReference: apiv1.LocalObjectReference{Name: "app"}, Key: "A"}}}}}}},
+			want: true,
+		},
+		{
+			name: "podSpecUsesSecretVolumeTest",
+			spec: apiv1.PodSpec{Volumes: []apiv1.Volume{{Name: "v", VolumeSource: apiv1.VolumeSource{Secret: &apiv1.SecretVolumeSource{SecretName: "app"}}}}},
+			want: true,
+		},
+		{
+			name: "podSpecUsesSecretProjectedTest",
+			spec: apiv1.PodSpec{Volumes: []apiv1.Volume{{Name: "v", VolumeSource: apiv1.VolumeSource{Projected: &apiv1.ProjectedVolumeSource{Sources: []apiv1.VolumeProjection{{Secret: &apiv1.SecretProjection{LocalObjectReference: apiv1.LocalObjectReference{Name: "app"}}}}}}}}},
+			want: true,
+		},
+		{
+			name: "podSpecUsesSecretOtherTest",
+			spec: apiv1.PodSpec{Containers: []apiv1.Container{{EnvFrom: []apiv1.EnvFromSource{{SecretRef: &apiv1.SecretEnvSource{LocalObjectReference: apiv1.LocalObjectReference{Name: "other"}}}}}}},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := podSpecUsesSecret(tt.spec, "app"); got != tt.want {
+				t.Errorf("podSpecUsesSecret() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// pod template using the secret through envFrom
+func envFromTemplate(secretName string) apiv1.PodTemplateSpec {
+	return apiv1.PodTemplateSpec{Spec: apiv1.PodSpec{Containers: []apiv1.Container{{
+		Name:    "app",
+		EnvFrom: []apiv1.EnvFromSource{{SecretRef: &apiv1.SecretEnvSource{LocalObjectReference: apiv1.LocalObjectReference{Name: secretName}}}},
+	}}}}
+}
+
+func Test_writeTargetSecretsRestartOnChange(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset(
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "test"}, Spec: appsv1.DeploymentSpec{Template: envFromTemplate("restartapp")}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "unrelated", Namespace: "test"}, Spec: appsv1.DeploymentSpec{Template: envFromTemplate("other")}},
+		&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "worker", Namespace: "test"}, Spec: appsv1.StatefulSetSpec{Template: envFromTemplate("restartapp")}},
+		&appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Name: "agent", Namespace: "test"}, Spec: appsv1.DaemonSetSpec{Template: envFromTemplate("restartapp")}},
+	)
+	c := AppConfig{restartOnChange: true}
+	target := Target{Name: "test", Namespace: "test"}
+	tests := []struct {
+		name        string
+		value       string
+		wantRestart bool
+	}{
+		{name: "restartOnChangeCreateTest", value: "one", wantRestart: false},
+		{name: "restartOnChangeUnchangedTest", value: "one", wantRestart: false},
+		{name: "restartOnChangeChangedTest", value: "two", wantRestart: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolved := []resolvedSecret{{Name: "restartapp", Values: map[string]interface{}{"A": tt.value}}}
+			err := writeTargetSecrets(c, target, staticClients(kubeClient), resolved)
+			if err != nil {
+				t.Fatalf("writeTargetSecrets() error = %v", err)
+			}
+			var restarted []string
+			deployments, _ := kubeClient.AppsV1().Deployments("test").List(context.TODO(), metav1.ListOptions{})
+			for _, x := range deployments.Items {
+				if x.Spec.Template.Annotations[restartedAtAnnotation] != "" {
+					restarted = append(restarted, "deployment/"+x.Name)
+				}
+			}
+			statefulSet, _ := kubeClient.AppsV1().StatefulSets("test").Get(context.TODO(), "worker", metav1.GetOptions{})
+			if statefulSet.Spec.Template.Annotations[restartedAtAnnotation] != "" {
+				restarted = append(restarted, "statefulset/worker")
+			}
+			daemonSet, _ := kubeClient.AppsV1().DaemonSets("test").Get(context.TODO(), "agent", metav1.GetOptions{})
+			if daemonSet.Spec.Template.Annotations[restartedAtAnnotation] != "" {
+				restarted = append(restarted, "daemonset/agent")
+			}
+			var want []string
+			if tt.wantRestart {
+				want = []string{"deployment/api", "statefulset/worker", "daemonset/agent"}
+			}
+			if !reflect.DeepEqual(restarted, want) {
+				t.Errorf("restarted workloads = %v, want %v", restarted, want)
+			}
+		})
+	}
+}
+
+func Test_parseWorkloadRef(t *testing.T) {
+	tests := []struct {
+		name     string
+		ref      string
+		wantKind string
+		wantName string
+		wantErr  bool
+	}{
+		{name: "parseWorkloadRefDeployTest", ref: "deploy/app-one", wantKind: "deployment", wantName: "app-one"},
+		{name: "parseWorkloadRefStatefulSetTest", ref: "StatefulSet/app-two", wantKind: "statefulset", wantName: "app-two"},
+		{name: "parseWorkloadRefDaemonSetTest", ref: "ds/agent", wantKind: "daemonset", wantName: "agent"},
+		{name: "parseWorkloadRefKindTest", ref: "pod/app-one", wantErr: true},
+		{name: "parseWorkloadRefNameTest", ref: "deploy/", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotKind, gotName, err := parseWorkloadRef(tt.ref)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseWorkloadRef() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if gotKind != tt.wantKind || gotName != tt.wantName {
+				t.Errorf("parseWorkloadRef() = %v, %v, want %v, %v", gotKind, gotName, tt.wantKind, tt.wantName)
+			}
+		})
+	}
+}
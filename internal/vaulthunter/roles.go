@@ -0,0 +1,475 @@
+package vaulthunter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// file within the vh folder configuring generated roles
+const rolesFile = "roles.yaml"
+
+// settings for generated jwt roles
+// ttls are seconds or durations, ex. 60 or 1h - an empty ttl is left to the defaults
+// namespace_path, environment and ref_protected are added to bound_claims, as are any other bound_claims
+type RoleTemplate struct {
+	TokenTTL            string                 `yaml:"token_ttl,omitempty"`
+	TokenMaxTTL         string                 `yaml:"token_max_ttl,omitempty"`
+	TokenExplicitMaxTTL string                 `yaml:"token_explicit_max_ttl,omitempty"`
+	UserClaim           string                 `yaml:"user_claim,omitempty"`
+	BoundClaimsType     string                 `yaml:"bound_claims_type,omitempty"`
+	BoundAudiences      []string               `yaml:"bound_audiences,omitempty"`
+	NamespacePath       string                 `yaml:"namespace_path,omitempty"`
+	Environment         string                 `yaml:"environment,omitempty"`
+	RefProtected        *bool                  `yaml:"ref_protected,omitempty"`
+	BoundClaims         map[string]interface{} `yaml:"bound_claims,omitempty"`
+	ClaimMappings       map[string]string      `yaml:"claim_mappings,omitempty"`
+	TokenBoundCIDRs     []string               `yaml:"token_bound_cidrs,omitempty"`
+	TokenPolicies       []string               `yaml:"token_policies,omitempty"`
+}
+
+// envs, or env globs, whose roles only accept ci jobs matching these claims
+// branches and tags are ref globs, a job must run on one of them
+// workflows are github job_workflow_ref globs, ref_protected is gitlab only
+type ProtectedEnv struct {
+	Envs         []string `yaml:"envs"`
+	Branches     []string `yaml:"branches,omitempty"`
+	Tags         []string `yaml:"tags,omitempty"`
+	RefProtected *bool    `yaml:"ref_protected,omitempty"`
+	Environment  string   `yaml:"environment,omitempty"`
+	Workflows    []string `yaml:"workflows,omitempty"`
+}
+
+// roles.yaml contents - defaults for every role, overrides per ci provider, protected env rules, then overrides per env
+// when protected is unset prod and qa are locked to the master branch, an empty list protects nothing
+type RolesConfig struct {
+	Defaults  RoleTemplate            `yaml:"defaults"`
+	Providers map[string]RoleTemplate `yaml:"providers"`
+	Protected []ProtectedEnv          `yaml:"protected"`
+	Envs      map[string]RoleTemplate `yaml:"envs"`
+}
+
+// a ci system whose jwts roles accept - the claim its project is bound with and the user_claim roles default to
+type ciProvider struct {
+	projectClaim string
+	userClaim    string
+}
+
+var ciProviders = map[string]ciProvider{
+	"gitlab": {projectClaim: "project_id", userClaim: "user_email"},
+	"github": {projectClaim: "repository", userClaim: "actor"},
+}
+
+// protected envs when roles.yaml doesn't declare any
+var defaultProtectedEnvs = []ProtectedEnv{{Envs: []string{"prod", "qa"}, Branches: []string{"master"}}}
+
+// claims vault-hunter sets itself
+var managedBoundClaims = []string{"project_id", "repository"}
+
+// what roles were generated with before roles.yaml
+func defaultRoleTemplate(provider string) RoleTemplate {
+	return RoleTemplate{
+		TokenExplicitMaxTTL: "60",
+		UserClaim:           ciProviders[provider].userClaim,
+		BoundClaimsType:     "glob",
+	}
+}
+
+// errors for unknown ci providers
+func checkCIProvider(provider string) error {
+	if _, ok := ciProviders[provider]; !ok {
+		return fmt.Errorf("unknown ci provider: %s - must be gitlab or github", provider)
+	}
+	return nil
+}
+
+// reads and validates vh/roles.yaml, a missing file is not an error
+func parseRoles(vhFolder string) (*RolesConfig, error) {
+	file := filepath.Join(vhFolder, rolesFile)
+	if !fileExists(file) {
+		return nil, nil
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read roles file: %s", err)
+	}
+	var roles RolesConfig
+	err = yaml.UnmarshalStrict(b, &roles)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse roles file %s: %s", file, err)
+	}
+	for i, x := range roles.Protected {
+		err := x.validate()
+		if err != nil {
+			return nil, fmt.Errorf("%s protected entry %d: %s", file, i+1, err)
+		}
+	}
+	// claims only one ci provider has are checked when roles are generated
+	base := mergeRoleTemplates(defaultRoleTemplate("gitlab"), roles.Defaults)
+	if _, err := base.role(); err != nil {
+		return nil, fmt.Errorf("%s defaults: %s", file, err)
+	}
+	for _, name := range sortedRoleTemplateKeys(roles.Providers) {
+		if err := checkCIProvider(name); err != nil {
+			return nil, fmt.Errorf("%s providers: %s", file, err)
+		}
+		if _, err := mergeRoleTemplates(base, roles.Providers[name]).role(); err != nil {
+			return nil, fmt.Errorf("%s provider %s: %s", file, name, err)
+		}
+	}
+	for _, env := range sortedRoleTemplateKeys(roles.Envs) {
+		if _, err := mergeRoleTemplates(base, roles.Envs[env]).role(); err != nil {
+			return nil, fmt.Errorf("%s env %s: %s", file, env, err)
+		}
+	}
+	return &roles, nil
+}
+
+// keys of a provider or env template map, sorted
+func sortedRoleTemplateKeys(m map[string]RoleTemplate) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// template for an env's role under a ci provider - the built in defaults, then roles.yaml defaults, the provider's overrides, the env's protected rule and the env's overrides
+func roleFor(rconfig *RolesConfig, env string, provider string) (RoleTemplate, error) {
+	if err := checkCIProvider(provider); err != nil {
+		return RoleTemplate{}, err
+	}
+	t := defaultRoleTemplate(provider)
+	if rconfig == nil {
+		rconfig = &RolesConfig{}
+	}
+	t = mergeRoleTemplates(t, rconfig.Defaults)
+	if override, ok := rconfig.Providers[provider]; ok {
+		t = mergeRoleTemplates(t, override)
+	}
+	protected := rconfig.Protected
+	if protected == nil {
+		protected = defaultProtectedEnvs
+	}
+	rule, protectedEnv := protectedEnvRule(protected, env)
+	if protectedEnv {
+		rt, err := rule.template(provider)
+		if err != nil {
+			return t, err
+		}
+		t = mergeRoleTemplates(t, rt)
+	}
+	if override, ok := rconfig.Envs[env]; ok {
+		t = mergeRoleTemplates(t, override)
+	}
+	// gitlab binds ref and ref_type independently, only protected refs keep a branch named like an allowed tag out
+	if provider == "gitlab" && protectedEnv && len(rule.Branches) > 0 && len(rule.Tags) > 0 && (t.RefProtected == nil || !*t.RefProtected) {
+		return t, fmt.Errorf("%s: gitlab roles can't bind branches and tags together without ref_protected: true, a branch named like an allowed tag would be accepted", env)
+	}
+	if provider == "github" && (t.NamespacePath != "" || t.RefProtected != nil) {
+		return t, fmt.Errorf("namespace_path and ref_protected are gitlab claims - set them under providers: gitlab: in %s", rolesFile)
+	}
+	return t, nil
+}
+
+// fields set in override win, bound_claims and claim_mappings are merged by key
+func mergeRoleTemplates(base RoleTemplate, override RoleTemplate) RoleTemplate {
+	merged := base
+	mergeString := func(dst *string, src string) {
+		if src != "" {
+			*dst = src
+		}
+	}
+	mergeString(&merged.TokenTTL, override.TokenTTL)
+	mergeString(&merged.TokenMaxTTL, override.TokenMaxTTL)
+	mergeString(&merged.TokenExplicitMaxTTL, override.TokenExplicitMaxTTL)
+	mergeString(&merged.UserClaim, override.UserClaim)
+	mergeString(&merged.BoundClaimsType, override.BoundClaimsType)
+	mergeString(&merged.NamespacePath, override.NamespacePath)
+	mergeString(&merged.Environment, override.Environment)
+	if override.RefProtected != nil {
+		merged.RefProtected = override.RefProtected
+	}
+	if override.BoundAudiences != nil {
+		merged.BoundAudiences = override.BoundAudiences
+	}
+	if override.TokenBoundCIDRs != nil {
+		merged.TokenBoundCIDRs = override.TokenBoundCIDRs
+	}
+	if override.TokenPolicies != nil {
+		merged.TokenPolicies = override.TokenPolicies
+	}
+	if base.BoundClaims != nil || override.BoundClaims != nil {
+		merged.BoundClaims = make(map[string]interface{})
+		for k, v := range base.BoundClaims {
+			merged.BoundClaims[k] = v
+		}
+		for k, v := range override.BoundClaims {
+			merged.BoundClaims[k] = v
+		}
+	}
+	if base.ClaimMappings != nil || override.ClaimMappings != nil {
+		merged.ClaimMappings = make(map[string]string)
+		for k, v := range base.ClaimMappings {
+			merged.ClaimMappings[k] = v
+		}
+		for k, v := range override.ClaimMappings {
+			merged.ClaimMappings[k] = v
+		}
+	}
+	return merged
+}
+
+// validates the template and builds the role it describes, without policies or a project id
+func (t RoleTemplate) role() (VaultRole, error) {
+	role := VaultRole{
+		RoleType:        "jwt",
+		UserClaim:       t.UserClaim,
+		BoundClaimsType: t.BoundClaimsType,
+		BoundAudiences:  t.BoundAudiences,
+		ClaimMappings:   t.ClaimMappings,
+		TokenBoundCIDRs: t.TokenBoundCIDRs,
+	}
+	var err error
+	if role.TokenTTL, err = parseRoleTTL("token_ttl", t.TokenTTL); err != nil {
+		return role, err
+	}
+	if role.TokenMaxTTL, err = parseRoleTTL("token_max_ttl", t.TokenMaxTTL); err != nil {
+		return role, err
+	}
+	if role.TokenExplicitMaxTTL, err = parseRoleTTL("token_explicit_max_ttl", t.TokenExplicitMaxTTL); err != nil {
+		return role, err
+	}
+	if role.TokenMaxTTL > 0 && role.TokenTTL > role.TokenMaxTTL {
+		return role, fmt.Errorf("token_ttl can't be greater than token_max_ttl")
+	}
+	if role.UserClaim == "" {
+		return role, fmt.Errorf("user_claim can't be empty")
+	}
+	if role.BoundClaimsType != "string" && role.BoundClaimsType != "glob" {
+		return role, fmt.Errorf("unknown bound_claims_type: %s - must be string or glob", role.BoundClaimsType)
+	}
+	for _, x := range t.BoundAudiences {
+		if x == "" {
+			return role, fmt.Errorf("bound_audiences can't contain an empty audience")
+		}
+	}
+	for _, x := range t.TokenBoundCIDRs {
+		if !validCIDR(x) {
+			return role, fmt.Errorf("invalid token_bound_cidrs entry: %s", x)
+		}
+	}
+	claims := make([]string, 0, len(t.ClaimMappings))
+	for claim := range t.ClaimMappings {
+		claims = append(claims, claim)
+	}
+	sort.Strings(claims)
+	targets := make(map[string]string)
+	for _, claim := range claims {
+		target := t.ClaimMappings[claim]
+		if claim == "" || target == "" {
+			return role, fmt.Errorf("claim_mappings can't contain empty claims or metadata keys")
+		}
+		// the jwt auth method sets the role metadata key itself
+		if target == "role" {
+			return role, fmt.Errorf("claim_mappings: metadata key role is reserved")
+		}
+		if other, ok := targets[target]; ok {
+			return role, fmt.Errorf("claim_mappings: %s and %s both map to metadata key %s", other, claim, target)
+		}
+		targets[target] = claim
+	}
+	role.BoundClaims = make(BoundClaims)
+	for k, v := range t.BoundClaims {
+		if containsString(managedBoundClaims, k) {
+			return role, fmt.Errorf("bound_claims: %s is set by vault-hunter", k)
+		}
+		claim, err := boundClaimValue(v)
+		if err != nil {
+			return role, fmt.Errorf("bound_claims: %s %s", k, err)
+		}
+		role.BoundClaims[k] = claim
+	}
+	if t.NamespacePath != "" {
+		role.BoundClaims["namespace_path"] = t.NamespacePath
+	}
+	if t.Environment != "" {
+		role.BoundClaims["environment"] = t.Environment
+	}
+	if t.RefProtected != nil {
+		role.BoundClaims["ref_protected"] = strconv.FormatBool(*t.RefProtected)
+	}
+	return role, nil
+}
+
+// first rule protecting the env
+func protectedEnvRule(rules []ProtectedEnv, env string) (ProtectedEnv, bool) {
+	for _, x := range rules {
+		for _, pattern := range x.Envs {
+			if ok, _ := path.Match(pattern, env); ok {
+				return x, true
+			}
+		}
+	}
+	return ProtectedEnv{}, false
+}
+
+// envs must be valid globs and at least one claim has to be constrained
+func (p ProtectedEnv) validate() error {
+	if len(p.Envs) == 0 {
+		return fmt.Errorf("envs can't be empty")
+	}
+	for _, x := range p.Envs {
+		if _, err := path.Match(x, ""); err != nil || x == "" {
+			return fmt.Errorf("invalid env pattern: %q", x)
+		}
+	}
+	for _, x := range append(append(append([]string{}, p.Branches...), p.Tags...), p.Workflows...) {
+		if x == "" {
+			return fmt.Errorf("branches, tags and workflows can't contain an empty entry")
+		}
+	}
+	if len(p.Branches) == 0 && len(p.Tags) == 0 && len(p.Workflows) == 0 && p.RefProtected == nil && p.Environment == "" {
+		return fmt.Errorf("set at least one of branches, tags, workflows, ref_protected or environment")
+	}
+	return nil
+}
+
+// bound claims a protected env rule adds to its envs' roles for a ci provider
+// gitlab branches and tags are bound together as ref and ref_type, roleFor requires ref_protected when both are set
+// github refs are full refs, ex. refs/heads/main, so branches and tags can't be confused
+func (p ProtectedEnv) template(provider string) (RoleTemplate, error) {
+	t := RoleTemplate{Environment: p.Environment}
+	var refs []string
+	switch provider {
+	case "gitlab":
+		if len(p.Workflows) > 0 {
+			return t, fmt.Errorf("workflows are only supported for github")
+		}
+		t.RefProtected = p.RefProtected
+		var refTypes []string
+		if len(p.Branches) > 0 {
+			refs = append(refs, p.Branches...)
+			refTypes = append(refTypes, "branch")
+		}
+		if len(p.Tags) > 0 {
+			refs = append(refs, p.Tags...)
+			refTypes = append(refTypes, "tag")
+		}
+		if len(refs) > 0 {
+			t.BoundClaims = map[string]interface{}{"ref": claimList(refs), "ref_type": claimList(refTypes)}
+		}
+	case "github":
+		if p.RefProtected != nil {
+			return t, fmt.Errorf("ref_protected is only supported for gitlab")
+		}
+		for _, x := range p.Branches {
+			refs = append(refs, "refs/heads/"+x)
+		}
+		for _, x := range p.Tags {
+			refs = append(refs, "refs/tags/"+x)
+		}
+		t.BoundClaims = make(map[string]interface{})
+		if len(refs) > 0 {
+			t.BoundClaims["ref"] = claimList(refs)
+		}
+		if len(p.Workflows) > 0 {
+			t.BoundClaims["job_workflow_ref"] = claimList(p.Workflows)
+		}
+	}
+	return t, nil
+}
+
+// single values are bound as a string, more as a list
+func claimList(values []string) interface{} {
+	if len(values) == 1 {
+		return values[0]
+	}
+	list := make([]interface{}, 0, len(values))
+	for _, x := range values {
+		list = append(list, x)
+	}
+	return list
+}
+
+// seconds in a ttl given as seconds or a duration, ex. 60 or 1h
+func parseRoleTTL(name string, ttl string) (int, error) {
+	if ttl == "" {
+		return 0, nil
+	}
+	seconds, err := strconv.Atoi(ttl)
+	if err != nil {
+		d, derr := time.ParseDuration(ttl)
+		if derr != nil {
+			return 0, fmt.Errorf("invalid %s: %s - must be seconds or a duration, ex. 1h", name, ttl)
+		}
+		if d%time.Second != 0 {
+			return 0, fmt.Errorf("invalid %s: %s - must be a whole number of seconds", name, ttl)
+		}
+		seconds = int(d / time.Second)
+	}
+	if seconds < 0 {
+		return 0, fmt.Errorf("invalid %s: %s - can't be negative", name, ttl)
+	}
+	return seconds, nil
+}
+
+// a cidr block or a single ip address
+func validCIDR(s string) bool {
+	if _, _, err := net.ParseCIDR(s); err == nil {
+		return true
+	}
+	return net.ParseIP(s) != nil
+}
+
+// bound claims are matched against the jwt's claims as strings, or as any of a list of strings
+func boundClaimValue(v interface{}) (interface{}, error) {
+	switch x := v.(type) {
+	case string:
+		return x, nil
+	case bool, int, int64, float64:
+		return fmt.Sprint(x), nil
+	case []interface{}:
+		if len(x) == 0 {
+			return nil, fmt.Errorf("can't be an empty list")
+		}
+		values := make([]string, 0, len(x))
+		for _, y := range x {
+			s, err := boundClaimValue(y)
+			if err != nil {
+				return nil, err
+			}
+			str, ok := s.(string)
+			if !ok {
+				return nil, fmt.Errorf("lists can only contain strings")
+			}
+			values = append(values, str)
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("must be a string or a list of strings")
+	}
+}
+
+// names of envs overridden in roles.yaml which no app defines
+func unknownRoleEnvs(rconfig *RolesConfig, envs []string) []string {
+	if rconfig == nil {
+		return nil
+	}
+	var unknown []string
+	for env := range rconfig.Envs {
+		if !containsString(envs, env) {
+			unknown = append(unknown, env)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
@@ -0,0 +1,303 @@
+package vaulthunter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_parseRoles(t *testing.T) {
+	type args struct {
+		vhFolder string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantNil bool
+		wantErr bool
+	}{
+		{
+			name: "testParseRoles",
+			args: args{vhFolder: "./../../mocks/roles/config"},
+		},
+		{
+			name:    "testParseRolesMissingFile",
+			args:    args{vhFolder: "./../../mocks/vh"},
+			wantNil: true,
+		},
+		{
+			name:    "testParseRolesInvalidEnv",
+			args:    args{vhFolder: "./../../mocks/roles/config-invalid"},
+			wantNil: true,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRoles(tt.args.vhFolder)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseRoles() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if (got == nil) != tt.wantNil {
+				t.Errorf("parseRoles() = %v, wantNil %v", got, tt.wantNil)
+			}
+		})
+	}
+}
+
+func Test_roleFor(t *testing.T) {
+	rconfig, err := parseRoles("./../../mocks/roles/config")
+	if err != nil {
+		t.Fatalf("parseRoles() error = %v", err)
+	}
+	refUnprotected := false
+	type args struct {
+		rconfig  *RolesConfig
+		env      string
+		provider string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    VaultRole
+		wantErr bool
+	}{
+		{
+			name: "testRoleForNoConfig",
+			args: args{rconfig: nil, env: "dev", provider: "gitlab"},
+			want: VaultRole{RoleType: "jwt", TokenExplicitMaxTTL: 60, UserClaim: "user_email", BoundClaimsType: "glob", BoundClaims: BoundClaims{}},
+		},
+		{
+			name: "testRoleForDefaults",
+			args: args{rconfig: rconfig, env: "dev", provider: "gitlab"},
+			want: VaultRole{
+				RoleType:            "jwt",
+				TokenExplicitMaxTTL: 60,
+				UserClaim:           "user_email",
+				BoundClaimsType:     "glob",
+				BoundClaims:         BoundClaims{"namespace_path": "testycat/*"},
+				TokenTTL:            300,
+				TokenMaxTTL:         900,
+				BoundAudiences:      []string{"https://vault.example.com"},
+				ClaimMappings:       map[string]string{"project_path": "project", "user_login": "user"},
+			},
+		},
+		{
+			name: "testRoleForProtectedGlob",
+			args: args{rconfig: rconfig, env: "prod-eu", provider: "gitlab"},
+			want: VaultRole{
+				RoleType:            "jwt",
+				TokenExplicitMaxTTL: 60,
+				UserClaim:           "user_email",
+				BoundClaimsType:     "glob",
+				BoundClaims:         BoundClaims{"namespace_path": "testycat/*", "environment": "production", "ref_protected": "true", "ref": []string{"main", "release/*", "v*"}, "ref_type": []string{"branch", "tag"}},
+				TokenTTL:            300,
+				TokenMaxTTL:         900,
+				BoundAudiences:      []string{"https://vault.example.com"},
+				ClaimMappings:       map[string]string{"project_path": "project", "user_login": "user"},
+			},
+		},
+		{
+			name: "testRoleForDefaultProtected",
+			args: args{rconfig: nil, env: "qa", provider: "gitlab"},
+			want: VaultRole{RoleType: "jwt", TokenExplicitMaxTTL: 60, UserClaim: "user_email", BoundClaimsType: "glob", BoundClaims: BoundClaims{"ref": "master", "ref_type": "branch"}},
+		},
+		{
+			name: "testRoleForNoProtected",
+			args: args{rconfig: &RolesConfig{Protected: []ProtectedEnv{}}, env: "prod", provider: "gitlab"},
+			want: VaultRole{RoleType: "jwt", TokenExplicitMaxTTL: 60, UserClaim: "user_email", BoundClaimsType: "glob", BoundClaims: BoundClaims{}},
+		},
+		{
+			name: "testRoleForGithubDefaultProtected",
+			args: args{rconfig: nil, env: "prod", provider: "github"},
+			want: VaultRole{RoleType: "jwt", TokenExplicitMaxTTL: 60, UserClaim: "actor", BoundClaimsType: "glob", BoundClaims: BoundClaims{"ref": "refs/heads/master"}},
+		},
+		{
+			name: "testRoleForGithubProtected",
+			args: args{
+				rconfig: &RolesConfig{
+					Providers: map[string]RoleTemplate{"gitlab": {NamespacePath: "testycat/*"}},
+					Protected: []ProtectedEnv{{Envs: []string{"prod"}, Branches: []string{"main"}, Tags: []string{"v*"}, Environment: "production", Workflows: []string{"testycat/workflows/.github/workflows/deploy.yml@*"}}},
+				},
+				env:      "prod",
+				provider: "github",
+			},
+			want: VaultRole{
+				RoleType:            "jwt",
+				TokenExplicitMaxTTL: 60,
+				UserClaim:           "actor",
+				BoundClaimsType:     "glob",
+				BoundClaims:         BoundClaims{"ref": []string{"refs/heads/main", "refs/tags/v*"}, "environment": "production", "job_workflow_ref": "testycat/workflows/.github/workflows/deploy.yml@*"},
+			},
+		},
+		{
+			name:    "testRoleForGithubGitlabClaims",
+			args:    args{rconfig: rconfig, env: "dev", provider: "github"},
+			wantErr: true,
+		},
+		{
+			name:    "testRoleForGitlabWorkflows",
+			args:    args{rconfig: &RolesConfig{Protected: []ProtectedEnv{{Envs: []string{"prod"}, Workflows: []string{"a/b/.github/workflows/c.yml@*"}}}}, env: "prod", provider: "gitlab"},
+			wantErr: true,
+		},
+		{
+			name:    "testRoleForGitlabBranchesAndTags",
+			args:    args{rconfig: &RolesConfig{Protected: []ProtectedEnv{{Envs: []string{"prod"}, Branches: []string{"main"}, Tags: []string{"v*"}}}}, env: "prod", provider: "gitlab"},
+			wantErr: true,
+		},
+		{
+			name:    "testRoleForGitlabBranchesAndTagsUnprotected",
+			args:    args{rconfig: &RolesConfig{Protected: []ProtectedEnv{{Envs: []string{"prod"}, Branches: []string{"main"}, Tags: []string{"v*"}, RefProtected: &refUnprotected}}}, env: "prod", provider: "gitlab"},
+			wantErr: true,
+		},
+		{
+			name: "testRoleForGitlabTags",
+			args: args{rconfig: &RolesConfig{Protected: []ProtectedEnv{{Envs: []string{"prod"}, Tags: []string{"v*"}}}}, env: "prod", provider: "gitlab"},
+			want: VaultRole{RoleType: "jwt", TokenExplicitMaxTTL: 60, UserClaim: "user_email", BoundClaimsType: "glob", BoundClaims: BoundClaims{"ref": "v*", "ref_type": "tag"}},
+		},
+		{
+			name:    "testRoleForUnknownProvider",
+			args:    args{rconfig: nil, env: "dev", provider: "jenkins"},
+			wantErr: true,
+		},
+		{
+			name: "testRoleForEnvOverride",
+			args: args{rconfig: rconfig, env: "prod", provider: "gitlab"},
+			want: VaultRole{
+				RoleType:            "jwt",
+				TokenExplicitMaxTTL: 60,
+				UserClaim:           "user_email",
+				BoundClaimsType:     "glob",
+				BoundClaims:         BoundClaims{"namespace_path": "testycat/*", "environment": "production", "ref_protected": "true", "pipeline_source": []string{"push", "web"}, "ref": []string{"main", "release/*", "v*"}, "ref_type": []string{"branch", "tag"}},
+				TokenTTL:            60,
+				TokenMaxTTL:         900,
+				BoundAudiences:      []string{"https://vault.example.com"},
+				ClaimMappings:       map[string]string{"project_path": "project", "user_login": "login"},
+				TokenBoundCIDRs:     []string{"10.0.0.0/8"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := roleFor(tt.args.rconfig, tt.args.env, tt.args.provider)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("roleFor() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got, err := tmpl.role()
+			if err != nil {
+				t.Fatalf("role() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("roleFor() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_RoleTemplate_role(t *testing.T) {
+	tests := []struct {
+		name    string
+		tmpl    RoleTemplate
+		wantErr bool
+	}{
+		{
+			name: "testRoleDefault",
+			tmpl: defaultRoleTemplate("gitlab"),
+		},
+		{
+			name:    "testRoleInvalidTTL",
+			tmpl:    mergeRoleTemplates(defaultRoleTemplate("gitlab"), RoleTemplate{TokenTTL: "soon"}),
+			wantErr: true,
+		},
+		{
+			name:    "testRoleTTLOverMax",
+			tmpl:    mergeRoleTemplates(defaultRoleTemplate("gitlab"), RoleTemplate{TokenTTL: "2h", TokenMaxTTL: "1h"}),
+			wantErr: true,
+		},
+		{
+			name:    "testRoleUnknownBoundClaimsType",
+			tmpl:    mergeRoleTemplates(defaultRoleTemplate("gitlab"), RoleTemplate{BoundClaimsType: "regex"}),
+			wantErr: true,
+		},
+		{
+			name:    "testRoleInvalidCIDR",
+			tmpl:    mergeRoleTemplates(defaultRoleTemplate("gitlab"), RoleTemplate{TokenBoundCIDRs: []string{"10.0.0/8"}}),
+			wantErr: true,
+		},
+		{
+			name:    "testRoleReservedClaimMapping",
+			tmpl:    mergeRoleTemplates(defaultRoleTemplate("gitlab"), RoleTemplate{ClaimMappings: map[string]string{"project_path": "role"}}),
+			wantErr: true,
+		},
+		{
+			name:    "testRoleDuplicateClaimMapping",
+			tmpl:    mergeRoleTemplates(defaultRoleTemplate("gitlab"), RoleTemplate{ClaimMappings: map[string]string{"project_path": "project", "project_id": "project"}}),
+			wantErr: true,
+		},
+		{
+			name:    "testRoleManagedBoundClaim",
+			tmpl:    mergeRoleTemplates(defaultRoleTemplate("gitlab"), RoleTemplate{BoundClaims: map[string]interface{}{"project_id": "1"}}),
+			wantErr: true,
+		},
+		{
+			name:    "testRoleNestedBoundClaim",
+			tmpl:    mergeRoleTemplates(defaultRoleTemplate("gitlab"), RoleTemplate{BoundClaims: map[string]interface{}{"user": map[interface{}]interface{}{"a": "b"}}}),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.tmpl.role(); (err != nil) != tt.wantErr {
+				t.Errorf("role() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_ProtectedEnv_validate(t *testing.T) {
+	refProtected := true
+	tests := []struct {
+		name    string
+		p       ProtectedEnv
+		wantErr bool
+	}{
+		{
+			name: "testProtectedEnvBranches",
+			p:    ProtectedEnv{Envs: []string{"prod"}, Branches: []string{"main"}},
+		},
+		{
+			name: "testProtectedEnvRefProtected",
+			p:    ProtectedEnv{Envs: []string{"prod-*"}, RefProtected: &refProtected},
+		},
+		{
+			name:    "testProtectedEnvNoEnvs",
+			p:       ProtectedEnv{Branches: []string{"main"}},
+			wantErr: true,
+		},
+		{
+			name:    "testProtectedEnvBadPattern",
+			p:       ProtectedEnv{Envs: []string{"prod-["}, Branches: []string{"main"}},
+			wantErr: true,
+		},
+		{
+			name:    "testProtectedEnvNoClaims",
+			p:       ProtectedEnv{Envs: []string{"prod"}},
+			wantErr: true,
+		},
+		{
+			name:    "testProtectedEnvEmptyTag",
+			p:       ProtectedEnv{Envs: []string{"prod"}, Tags: []string{""}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.p.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
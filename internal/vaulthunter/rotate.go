@@ -0,0 +1,131 @@
+package vaulthunter
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	vapi "github.com/hashicorp/vault/api"
+)
+
+// characters generated values are made of when -charset is unset
+const defaultRotateCharset = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+// outcome of re-creating an app's secrets in an env after a rotation
+type rotateResult struct {
+	App     string
+	Env     string
+	Secrets []string
+	Status  string
+}
+
+// random value of length characters drawn from charset
+func generateSecretValue(length int, charset string) (string, error) {
+	if charset == "" {
+		charset = defaultRotateCharset
+	}
+	chars := []rune(charset)
+	if length <= 0 {
+		return "", fmt.Errorf("length must be greater than 0")
+	}
+	var b strings.Builder
+	max := big.NewInt(int64(len(chars)))
+	for i := 0; i < length; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("unable to generate value: %s", err)
+		}
+		b.WriteRune(chars[n.Int64()])
+	}
+	return b.String(), nil
+}
+
+// value to rotate to - either -value or, with -generate, a random one
+func rotateValue(c AppConfig) (string, error) {
+	if c.rotateGenerate == (c.rotateValue != "") {
+		return "", fmt.Errorf("pass one of -generate or -value")
+	}
+	if c.rotateGenerate {
+		return generateSecretValue(c.rotateLength, c.rotateCharset)
+	}
+	return c.rotateValue, nil
+}
+
+// writes value to the vault path and key, then re-creates every secret in every app and env reading it
+// when rotating across all envs, envs without declared targets are skipped as they would all be written to the same -namespace
+func rotateSecret(c AppConfig, client *vapi.Client, clients kubeClientFactory, value string) ([]rotateResult, error) {
+	refs, err := findReferences(c, c.rotatePath, c.rotateKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(refs) == 0 {
+		return nil, fmt.Errorf("no maps reference %s#%s", c.rotatePath, c.rotateKey)
+	}
+	existing, version, err := readSeedPath(client, c.rotatePath)
+	if err != nil {
+		return nil, err
+	}
+	err = applySeed(client, []seedWrite{{
+		Path:     c.rotatePath,
+		Version:  version,
+		Existing: existing,
+		Values:   map[string]string{c.rotateKey: value},
+		Changes:  []seedChange{{Key: c.rotateKey, Action: "update"}},
+	}})
+	if err != nil {
+		return nil, err
+	}
+	tconfig, err := parseTargets(c.vhFolder)
+	if err != nil {
+		return nil, err
+	}
+	// secrets to re-create, grouped by app and env
+	affected := make(map[[2]string][]string)
+	var order [][2]string
+	for _, r := range refs {
+		k := [2]string{r.App, r.Env}
+		if _, ok := affected[k]; !ok {
+			order = append(order, k)
+		}
+		if !containsString(affected[k], r.Secret) {
+			affected[k] = append(affected[k], r.Secret)
+		}
+	}
+	var results []rotateResult
+	for _, k := range order {
+		app, env := k[0], k[1]
+		secrets := affected[k]
+		sort.Strings(secrets)
+		ac := c
+		ac.configEnv = env
+		ac.apps = []string{app}
+		ac.secretNames = secrets
+		result := rotateResult{App: app, Env: env, Secrets: secrets, Status: "updated"}
+		if c.configEnv == "" && len(declaredTargets(ac, app, mergeConfig(c.vhFolder+"/"+app, env), tconfig)) == 0 {
+			result.Status = "skipped - no targets declared, pass -env to use -kube-config/-namespace"
+			results = append(results, result)
+			continue
+		}
+		err := createSecrets(ac, client, clients)
+		if err != nil {
+			result.Status = "failed - " + err.Error()
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// summary table of a rotation
+func formatRotateSummary(results []rotateResult) string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "APP\tENV\tSECRETS\tSTATUS")
+	for _, x := range results {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", x.App, x.Env, strings.Join(x.Secrets, ","), x.Status)
+	}
+	w.Flush()
+	return b.String()
+}
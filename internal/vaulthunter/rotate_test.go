@@ -0,0 +1,152 @@
+package vaulthunter
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_generateSecretValue(t *testing.T) {
+	type args struct {
+		length  int
+		charset string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+	}{
+		{name: "generateSecretValueDefaultTest", args: args{length: 32}},
+		{name: "generateSecretValueCharsetTest", args: args{length: 16, charset: "ab☃"}},
+		{name: "generateSecretValueLengthTest", args: args{length: 0}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := generateSecretValue(tt.args.length, tt.args.charset)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("generateSecretValue() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			charset := tt.args.charset
+			if charset == "" {
+				charset = defaultRotateCharset
+			}
+			if len([]rune(got)) != tt.args.length {
+				t.Errorf("generateSecretValue() = %q, want length %d", got, tt.args.length)
+			}
+			for _, r := range got {
+				if !strings.ContainsRune(charset, r) {
+					t.Errorf("generateSecretValue() = %q, %q not in charset", got, r)
+				}
+			}
+		})
+	}
+}
+
+func Test_rotateValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		c       AppConfig
+		want    string
+		wantErr bool
+	}{
+		{name: "rotateValueTest", c: AppConfig{rotateValue: "new"}, want: "new"},
+		{name: "rotateValueNeitherTest", c: AppConfig{}, wantErr: true},
+		{name: "rotateValueBothTest", c: AppConfig{rotateValue: "new", rotateGenerate: true, rotateLength: 8}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rotateValue(tt.c)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("rotateValue() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("rotateValue() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_findReferences(t *testing.T) {
+	type args struct {
+		c   AppConfig
+		p   string
+		key string
+	}
+	c := AppConfig{vhFolder: "./../../mocks/vh", apps: []string{"rotateapp"}}
+	tests := []struct {
+		name string
+		args args
+		want []secretReference
+	}{
+		{
+			name: "findReferencesKeyTest",
+			args: args{c: c, p: "secret/location/one/config/rotate", key: "password"},
+			want: []secretReference{
+				{App: "rotateapp", Env: "dev", Secret: "rotateapp", Var: "RABBIT_PASS", Path: "secret/location/one/config/rotate", Key: "password"},
+				{App: "rotateapp", Env: "prod", Secret: "rotateapp", Var: "RABBIT_PASS", Path: "secret/location/one/config/rotate", Key: "password"},
+				{App: "rotateapp", Env: "prod", Secret: "rotateapp-rabbit", Var: "RABBIT_PASSWORD", Path: "secret/location/one/config/rotate", Key: "password"},
+			},
+		},
+		{
+			name: "findReferencesFilteredTest",
+			args: args{c: c, p: "/secret/location/one/config/rotate/", key: "user"},
+			want: []secretReference{
+				{App: "rotateapp", Env: "dev", Secret: "rotateapp", Var: "RABBIT_USER", Path: "secret/location/one/config/rotate", Key: "user"},
+				{App: "rotateapp", Env: "prod", Secret: "rotateapp", Var: "RABBIT_USER", Path: "secret/location/one/config/rotate", Key: "user"},
+			},
+		},
+		{
+			name: "findReferencesEnvTest",
+			args: args{c: AppConfig{vhFolder: "./../../mocks/vh", configEnv: "dev", apps: []string{"rotateapp"}}, p: "secret/location/one/config/rotate", key: "password"},
+			want: []secretReference{
+				{App: "rotateapp", Env: "dev", Secret: "rotateapp", Var: "RABBIT_PASS", Path: "secret/location/one/config/rotate", Key: "password"},
+			},
+		},
+		{
+			// seedapp has no prod.yaml, so no prod policy, role or secret is generated for it
+			name: "findReferencesDefinedEnvsTest",
+			args: args{c: AppConfig{vhFolder: "./../../mocks/vh", apps: []string{"rotateapp", "seedapp"}}, p: "secret/location/one/config/seed", key: "user"},
+			want: []secretReference{
+				{App: "seedapp", Env: "dev", Secret: "seedapp", Var: "DB_USER", Path: "secret/location/one/config/seed", Key: "user"},
+			},
+		},
+		{
+			name: "findReferencesUndefinedEnvTest",
+			args: args{c: AppConfig{vhFolder: "./../../mocks/vh", configEnv: "prod", apps: []string{"seedapp"}}, p: "secret/location/one/config/seed", key: "user"},
+		},
+		{
+			name: "findReferencesNoneTest",
+			args: args{c: c, p: "secret/location/one/config/nope", key: "password"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := findReferences(tt.args.c, tt.args.p, tt.args.key)
+			if err != nil {
+				t.Errorf("findReferences() error = %v", err)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findReferences() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_formatRotateSummary(t *testing.T) {
+	results := []rotateResult{
+		{App: "app-one", Env: "dev", Secrets: []string{"app-one"}, Status: "updated"},
+		{App: "app-one", Env: "prod", Secrets: []string{"app-one", "app-one-rabbit"}, Status: "failed - boom"},
+	}
+	want := "APP      ENV   SECRETS                 STATUS\n" +
+		"app-one  dev   app-one                 updated\n" +
+		"app-one  prod  app-one,app-one-rabbit  failed - boom\n"
+	if got := formatRotateSummary(results); got != want {
+		t.Errorf("formatRotateSummary() = \n%s\nwant\n%s", got, want)
+	}
+}
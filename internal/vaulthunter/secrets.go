@@ -0,0 +1,137 @@
+package vaulthunter
+
+import (
+	"fmt"
+	"sort"
+
+	vapi "github.com/hashicorp/vault/api"
+)
+
+// an additional k8s secret defined in a map's "secrets" list
+// type defaults to Opaque, ex. kubernetes.io/dockerconfigjson or kubernetes.io/tls
+type SecretDef struct {
+	Name                  string                `yaml:"name"`
+	Type                  string                `yaml:"type,omitempty"`
+	KeyConfig             KeyConfig             `yaml:"key_config"`
+	FullSecretConfigPaths FullSecretConfigPaths `yaml:"full_secret_config_paths"`
+}
+
+// values looked up for a single k8s secret
+type resolvedSecret struct {
+	Name   string
+	Type   string
+	Keys   KeyConfig
+	Values map[string]interface{}
+}
+
+// all secrets defined by a map - the top level secret_name form first, followed by the "secrets" list
+// the top level form is skipped when it has no keys and a "secrets" list is used
+func (s SecretConfig) secretDefs() ([]SecretDef, error) {
+	var defs []SecretDef
+	seen := make(map[string]bool)
+	if len(s.KeyConfig) > 0 || len(s.FullSecretConfigPaths) > 0 || len(s.Secrets) == 0 {
+		defs = append(defs, SecretDef{Name: s.SecretName, KeyConfig: s.KeyConfig, FullSecretConfigPaths: s.FullSecretConfigPaths})
+		seen[s.SecretName] = true
+	}
+	for _, x := range s.Secrets {
+		if x.Name == "" {
+			return nil, fmt.Errorf("secrets entry is missing a name")
+		}
+		if seen[x.Name] {
+			return nil, fmt.Errorf("secret %s is defined more than once", x.Name)
+		}
+		seen[x.Name] = true
+		defs = append(defs, x)
+	}
+	return defs, nil
+}
+
+// merges the "secrets" lists of a base and env map by name
+// env keys overwrite base keys and env full secret paths take precedence over base paths
+func mergeSecretDefs(base []SecretDef, env []SecretDef) []SecretDef {
+	if len(base) == 0 && len(env) == 0 {
+		return nil
+	}
+	merged := make([]SecretDef, 0, len(base)+len(env))
+	index := make(map[string]int)
+	for _, x := range base {
+		index[x.Name] = len(merged)
+		merged = append(merged, x)
+	}
+	for _, x := range env {
+		for i := range x.FullSecretConfigPaths {
+			x.FullSecretConfigPaths[i].layer = 1
+		}
+		i, ok := index[x.Name]
+		if !ok {
+			index[x.Name] = len(merged)
+			merged = append(merged, x)
+			continue
+		}
+		if x.Type != "" {
+			merged[i].Type = x.Type
+		}
+		keys := make(KeyConfig)
+		for k, v := range merged[i].KeyConfig {
+			keys[k] = v
+		}
+		for k, v := range x.KeyConfig {
+			keys[k] = v
+		}
+		merged[i].KeyConfig = keys
+		merged[i].FullSecretConfigPaths = append(append(FullSecretConfigPaths{}, merged[i].FullSecretConfigPaths...), x.FullSecretConfigPaths...)
+	}
+	return merged
+}
+
+// looks up the values of every secret defined by the map
+func resolveSecrets(client *vapi.Client, data SecretConfig) ([]resolvedSecret, error) {
+	defs, err := data.secretDefs()
+	if err != nil {
+		return nil, err
+	}
+	var resolved []resolvedSecret
+	for _, x := range defs {
+		_, values, err := getSecretsFromConfig(client, SecretConfig{SecretName: x.Name, KeyConfig: x.KeyConfig, FullSecretConfigPaths: x.FullSecretConfigPaths})
+		if err != nil {
+			return nil, fmt.Errorf("secret %s: %s", x.Name, err)
+		}
+		resolved = append(resolved, resolvedSecret{Name: x.Name, Type: x.Type, Keys: x.KeyConfig, Values: values})
+	}
+	return resolved, nil
+}
+
+// only the named secrets, all of them when names is empty
+func filterSecrets(resolved []resolvedSecret, names []string) []resolvedSecret {
+	if len(names) == 0 {
+		return resolved
+	}
+	var filtered []resolvedSecret
+	for _, x := range resolved {
+		if containsString(names, x.Name) {
+			filtered = append(filtered, x)
+		}
+	}
+	return filtered
+}
+
+// flattens all secrets into a single map, used for env files - a key set by more than one secret is an error
+func combineSecrets(resolved []resolvedSecret) (map[string]interface{}, error) {
+	combined := make(map[string]interface{})
+	owners := make(map[string]string)
+	for _, x := range resolved {
+		keys := make([]string, 0, len(x.Values))
+		for k := range x.Values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if owner, ok := owners[k]; ok {
+				return nil, fmt.Errorf("key %s is set by both secret %s and secret %s", k, owner, x.Name)
+			}
+			owners[k] = x.Name
+			combined[k] = x.Values[k]
+		}
+	}
+	return combined, nil
+}
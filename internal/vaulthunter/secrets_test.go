@@ -0,0 +1,118 @@
+package vaulthunter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_secretDefs(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    SecretConfig
+		wantNames []string
+		wantErr   bool
+	}{
+		{
+			name:      "secretDefsSingleTest",
+			config:    SecretConfig{SecretName: "app", KeyConfig: KeyConfig{"A": {Path: "secret/a", Key: "a"}}},
+			wantNames: []string{"app"},
+		},
+		{
+			name: "secretDefsMultipleTest",
+			config: SecretConfig{SecretName: "app", KeyConfig: KeyConfig{"A": {Path: "secret/a", Key: "a"}}, Secrets: []SecretDef{
+				{Name: "app-db", KeyConfig: KeyConfig{"B": {Path: "secret/b", Key: "b"}}},
+			}},
+			wantNames: []string{"app", "app-db"},
+		},
+		{
+			name:      "secretDefsListOnlyTest",
+			config:    SecretConfig{SecretName: "app", Secrets: []SecretDef{{Name: "app-db"}}},
+			wantNames: []string{"app-db"},
+		},
+		{
+			name:    "secretDefsDuplicateTest",
+			config:  SecretConfig{SecretName: "app", KeyConfig: KeyConfig{"A": {Path: "secret/a", Key: "a"}}, Secrets: []SecretDef{{Name: "app"}}},
+			wantErr: true,
+		},
+		{
+			name:    "secretDefsMissingNameTest",
+			config:  SecretConfig{Secrets: []SecretDef{{Type: "Opaque"}}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.config.secretDefs()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("secretDefs() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			var names []string
+			for _, x := range got {
+				names = append(names, x.Name)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(names, tt.wantNames) {
+				t.Errorf("secretDefs() = %v, want %v", names, tt.wantNames)
+			}
+		})
+	}
+}
+
+func Test_mergeSecretDefs(t *testing.T) {
+	base := []SecretDef{
+		{Name: "app-db", KeyConfig: KeyConfig{"USER": {Path: "secret/db", Key: "user"}, "PASS": {Path: "secret/db", Key: "pass"}}},
+		{Name: "app-mq", FullSecretConfigPaths: FullSecretConfigPaths{{Path: "secret/mq"}}},
+	}
+	env := []SecretDef{
+		{Name: "app-db", Type: "Opaque", KeyConfig: KeyConfig{"PASS": {Path: "secret/db/prod", Key: "pass"}}},
+		{Name: "app-tls", Type: "kubernetes.io/tls", FullSecretConfigPaths: FullSecretConfigPaths{{Path: "secret/tls"}}},
+	}
+	want := []SecretDef{
+		{Name: "app-db", Type: "Opaque", KeyConfig: KeyConfig{"USER": {Path: "secret/db", Key: "user"}, "PASS": {Path: "secret/db/prod", Key: "pass"}}, FullSecretConfigPaths: FullSecretConfigPaths{}},
+		{Name: "app-mq", FullSecretConfigPaths: FullSecretConfigPaths{{Path: "secret/mq"}}},
+		{Name: "app-tls", Type: "kubernetes.io/tls", FullSecretConfigPaths: FullSecretConfigPaths{{Path: "secret/tls", layer: 1}}},
+	}
+	t.Run("mergeSecretDefsTest", func(t *testing.T) {
+		if got := mergeSecretDefs(base, env); !reflect.DeepEqual(got, want) {
+			t.Errorf("mergeSecretDefs() \ngot = \n%v, \nwant \n%v", got, want)
+		}
+	})
+}
+
+func Test_combineSecrets(t *testing.T) {
+	tests := []struct {
+		name     string
+		resolved []resolvedSecret
+		want     map[string]interface{}
+		wantErr  bool
+	}{
+		{
+			name: "combineSecretsTest",
+			resolved: []resolvedSecret{
+				{Name: "app", Values: map[string]interface{}{"A": "1"}},
+				{Name: "app-db", Values: map[string]interface{}{"B": "2"}},
+			},
+			want: map[string]interface{}{"A": "1", "B": "2"},
+		},
+		{
+			name: "combineSecretsCollisionTest",
+			resolved: []resolvedSecret{
+				{Name: "app", Values: map[string]interface{}{"A": "1"}},
+				{Name: "app-db", Values: map[string]interface{}{"A": "2"}},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := combineSecrets(tt.resolved)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("combineSecrets() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("combineSecrets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,387 @@
+package vaulthunter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	vapi "github.com/hashicorp/vault/api"
+)
+
+// a single vault key a seed file sets
+type seedChange struct {
+	Key    string
+	Var    string
+	Action string
+}
+
+// the write planned for a single vault path
+// version is the secret's current version, used for check-and-set - 0 when the secret doesn't exist yet
+type seedWrite struct {
+	Path     string
+	Version  int
+	Existing map[string]interface{}
+	Values   map[string]string
+	Changes  []seedChange
+}
+
+// a vault path and key a seed file variable is written to
+type seedKey struct {
+	Path string
+	Key  string
+	Var  string
+}
+
+// reads a seed file - a json object when the file ends in .json, otherwise a dotenv/shell env file
+func parseSeedFile(file string) (map[string]string, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read seed file: %s", err)
+	}
+	if strings.EqualFold(filepath.Ext(file), ".json") {
+		var obj map[string]interface{}
+		err = json.Unmarshal(b, &obj)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse seed file %s: %s", file, err)
+		}
+		values := make(map[string]string)
+		for k, v := range obj {
+			values[k] = secretValueString(v)
+		}
+		return values, nil
+	}
+	values, err := parseDotenv(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse seed file %s: %s", file, err)
+	}
+	return values, nil
+}
+
+// parses KEY=value lines as written by generate-env-file's shell and dotenv formats
+// "export " is optional, double quoted values may span lines and unescape \n, \r, \\, \", \$ and \`, single quoted values are literal
+func parseDotenv(s string) (map[string]string, error) {
+	values := make(map[string]string)
+	line := 1
+	for len(s) > 0 {
+		// skip blank lines and comments
+		trimmed := strings.TrimLeft(s, " \t\r")
+		if trimmed == "" {
+			break
+		}
+		if trimmed[0] == '\n' || trimmed[0] == '#' {
+			i := strings.IndexByte(trimmed, '\n')
+			if i < 0 {
+				break
+			}
+			s = trimmed[i+1:]
+			line++
+			continue
+		}
+		s = strings.TrimPrefix(trimmed, "export ")
+		eq := strings.IndexAny(s, "=\n")
+		if eq < 0 || s[eq] != '=' {
+			return nil, fmt.Errorf("line %d: expected KEY=value", line)
+		}
+		key := strings.TrimSpace(s[:eq])
+		if key == "" {
+			return nil, fmt.Errorf("line %d: missing key", line)
+		}
+		s = s[eq+1:]
+		var value string
+		switch {
+		case strings.HasPrefix(s, `"`):
+			var b strings.Builder
+			i := 1
+			closed := false
+			for ; i < len(s); i++ {
+				c := s[i]
+				if c == '"' {
+					closed = true
+					break
+				}
+				if c == '\n' {
+					line++
+				}
+				if c == '\\' && i+1 < len(s) {
+					i++
+					switch s[i] {
+					case 'n':
+						b.WriteByte('\n')
+					case 'r':
+						b.WriteByte('\r')
+					case '\\', '"', '$', '`':
+						b.WriteByte(s[i])
+					default:
+						b.WriteByte('\\')
+						b.WriteByte(s[i])
+					}
+					continue
+				}
+				b.WriteByte(c)
+			}
+			if !closed {
+				return nil, fmt.Errorf("line %d: unterminated quoted value for %s", line, key)
+			}
+			value = b.String()
+			s = s[i+1:]
+		case strings.HasPrefix(s, "'"):
+			end := strings.IndexByte(s[1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated quoted value for %s", line, key)
+			}
+			value = s[1 : end+1]
+			line += strings.Count(value, "\n")
+			s = s[end+2:]
+		default:
+			end := strings.IndexByte(s, '\n')
+			if end < 0 {
+				end = len(s)
+			}
+			value = s[:end]
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = value[:i]
+			}
+			value = strings.TrimSpace(value)
+			s = s[end:]
+		}
+		values[key] = value
+		// anything after the value on its line must be a comment
+		end := strings.IndexByte(s, '\n')
+		rest := s
+		if end >= 0 {
+			rest = s[:end]
+			s = s[end+1:]
+		} else {
+			s = ""
+		}
+		rest = strings.TrimSpace(rest)
+		if rest != "" && !strings.HasPrefix(rest, "#") {
+			return nil, fmt.Errorf("line %d: unexpected %q after value for %s", line, rest, key)
+		}
+		line++
+	}
+	return values, nil
+}
+
+// maps seed file variables to the vault path and key the map reads them from
+// only plain path/key entries can be seeded, variables the map doesn't define or reads another way are returned as skipped
+func seedKeys(data SecretConfig, values map[string]string) ([]seedKey, []string, error) {
+	defs, err := data.secretDefs()
+	if err != nil {
+		return nil, nil, err
+	}
+	var keys []seedKey
+	var skipped []string
+	names := make([]string, 0, len(values))
+	for k := range values {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		found := false
+		for _, d := range defs {
+			v, ok := d.KeyConfig[name]
+			if !ok {
+				continue
+			}
+			found = true
+			switch {
+			case v.Value != nil || v.FromEnv != "":
+				skipped = append(skipped, name+" (not a vault value)")
+			case v.Path == "" || len(v.Inputs) > 0 || len(v.Transform) > 0 || v.Base64:
+				skipped = append(skipped, name+" (transformed or composed values can't be reversed)")
+			case strings.Contains(v.Path, envVarNotFound):
+				return nil, nil, fmt.Errorf("%s reads from %s, which uses an env var that isn't set", name, v.Path)
+			default:
+				keys = append(keys, seedKey{Path: v.Path, Key: v.Key, Var: name})
+			}
+		}
+		if !found {
+			skipped = append(skipped, name+" (not in key_config)")
+		}
+	}
+	return keys, skipped, nil
+}
+
+// groups seed keys by vault path, two variables setting the same path and key to different values is an error
+func groupSeedKeys(keys []seedKey, values map[string]string) (map[string]map[string]seedKey, error) {
+	grouped := make(map[string]map[string]seedKey)
+	for _, x := range keys {
+		if grouped[x.Path] == nil {
+			grouped[x.Path] = make(map[string]seedKey)
+		}
+		if prev, ok := grouped[x.Path][x.Key]; ok && values[prev.Var] != values[x.Var] {
+			return nil, fmt.Errorf("%s and %s both set %s/%s to different values", prev.Var, x.Var, x.Path, x.Key)
+		}
+		grouped[x.Path][x.Key] = x
+	}
+	return grouped, nil
+}
+
+// reads the current value of each path and works out what would change
+func planSeed(client *vapi.Client, grouped map[string]map[string]seedKey, values map[string]string) ([]seedWrite, error) {
+	paths := make([]string, 0, len(grouped))
+	for p := range grouped {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	var writes []seedWrite
+	for _, p := range paths {
+		existing, version, err := readSeedPath(client, p)
+		if err != nil {
+			return nil, err
+		}
+		w := seedWrite{Path: p, Version: version, Existing: existing, Values: make(map[string]string)}
+		keys := make([]string, 0, len(grouped[p]))
+		for k := range grouped[p] {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			x := grouped[p][k]
+			w.Values[k] = values[x.Var]
+			action := "add"
+			if cur, ok := existing[k]; ok {
+				action = "update"
+				if secretValueString(cur) == values[x.Var] {
+					action = "unchanged"
+				}
+			}
+			w.Changes = append(w.Changes, seedChange{Key: k, Var: x.Var, Action: action})
+		}
+		writes = append(writes, w)
+	}
+	return writes, nil
+}
+
+// current data and version of a kv v2 secret, a missing secret has no data and version 0
+// a deleted or destroyed version has no data but keeps its version, which check-and-set needs to write over it
+func readSeedPath(client *vapi.Client, p string) (map[string]interface{}, int, error) {
+	secret, err := client.Logical().Read(modSecretPath(p))
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to read %s: %s", p, err)
+	}
+	if secret == nil || secret.Data == nil {
+		return map[string]interface{}{}, 0, nil
+	}
+	// kv v1 style secrets keep their keys at the top level, like lookupSecretValue
+	data := secret.Data
+	if isDeletedVersion(secret) {
+		data = map[string]interface{}{}
+	} else if secret.Data["data"] != nil {
+		objects, ok := secret.Data["data"].(map[string]interface{})
+		if !ok {
+			return nil, 0, fmt.Errorf("could not decode v2 secret %s", p)
+		}
+		data = objects
+	}
+	version := 0
+	if metadata, ok := secret.Data["metadata"].(map[string]interface{}); ok {
+		switch v := metadata["version"].(type) {
+		case json.Number:
+			n, _ := v.Int64()
+			version = int(n)
+		case float64:
+			version = int(v)
+		case int:
+			version = v
+		}
+	}
+	return data, version, nil
+}
+
+// true when the write changes at least one key
+func (w seedWrite) changed() bool {
+	for _, x := range w.Changes {
+		if x.Action != "unchanged" {
+			return true
+		}
+	}
+	return false
+}
+
+// diff of the planned writes, values are never printed
+func formatSeedPlan(writes []seedWrite) string {
+	symbols := map[string]string{"add": "+", "update": "~", "unchanged": "="}
+	var b strings.Builder
+	for _, w := range writes {
+		if w.Version == 0 && len(w.Existing) == 0 {
+			fmt.Fprintf(&b, "%s (new)\n", w.Path)
+		} else {
+			fmt.Fprintf(&b, "%s (version %d)\n", w.Path, w.Version)
+		}
+		for _, x := range w.Changes {
+			fmt.Fprintf(&b, "  %s %s (from %s)\n", symbols[x.Action], x.Key, x.Var)
+		}
+	}
+	return b.String()
+}
+
+// writes each changed path, keeping keys the seed file doesn't set
+// check-and-set fails the write if the secret changed since it was read
+func applySeed(client *vapi.Client, writes []seedWrite) error {
+	for _, w := range writes {
+		if !w.changed() {
+			continue
+		}
+		data := make(map[string]interface{}, len(w.Existing)+len(w.Values))
+		for k, v := range w.Existing {
+			data[k] = v
+		}
+		for k, v := range w.Values {
+			data[k] = v
+		}
+		_, err := client.Logical().Write(modSecretPath(w.Path), map[string]interface{}{
+			"data":    data,
+			"options": map[string]interface{}{"cas": w.Version},
+		})
+		if err != nil {
+			return fmt.Errorf("unable to write %s: %s", w.Path, err)
+		}
+		log.Printf("INFO: wrote %d key(s) to %s", len(w.Values), w.Path)
+	}
+	return nil
+}
+
+// plans writing the seed file's values to the vault paths the apps' maps read them from, applySeed writes the plan
+func seedSecrets(c AppConfig, client *vapi.Client, values map[string]string) ([]seedWrite, error) {
+	apps, err := selectedApps(c)
+	if err != nil {
+		return nil, err
+	}
+	var keys []seedKey
+	mapped := make(map[string]bool)
+	for _, x := range apps {
+		data := mergeConfig(c.vhFolder+"/"+x, c.configEnv)
+		appKeys, skipped, err := seedKeys(data, values)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", x, err)
+		}
+		for _, k := range appKeys {
+			mapped[k.Var] = true
+		}
+		for _, s := range skipped {
+			debugLog(fmt.Sprintf("DEBUG: %s: skipping %s", x, s), false)
+		}
+		keys = append(keys, appKeys...)
+	}
+	var unmapped []string
+	for k := range values {
+		if !mapped[k] {
+			unmapped = append(unmapped, k)
+		}
+	}
+	sort.Strings(unmapped)
+	if len(unmapped) > 0 {
+		log.Printf("WARN: no vault path/key found for: %s", strings.Join(unmapped, ", "))
+	}
+	grouped, err := groupSeedKeys(keys, values)
+	if err != nil {
+		return nil, err
+	}
+	return planSeed(client, grouped, values)
+}
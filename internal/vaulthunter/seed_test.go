@@ -0,0 +1,203 @@
+package vaulthunter
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_parseDotenv(t *testing.T) {
+	type args struct {
+		s string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "parseDotenvTest",
+			args: args{s: "# comment\n\nexport A=\"x\\\"y\\$z\"\nB='lit $eral'\nC=plain value # trailing\n  D=\"two\nlines\" # note\nE=\"a\\nb\"\nF=\n"},
+			want: map[string]string{"A": `x"y$z`, "B": "lit $eral", "C": "plain value", "D": "two\nlines", "E": "a\nb", "F": ""},
+		},
+		{
+			name:    "parseDotenvUnterminatedTest",
+			args:    args{s: "A=\"open\n"},
+			wantErr: true,
+		},
+		{
+			name:    "parseDotenvMissingEqualsTest",
+			args:    args{s: "A\n"},
+			wantErr: true,
+		},
+		{
+			name:    "parseDotenvTrailingTest",
+			args:    args{s: "A=\"x\" y\n"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDotenv(tt.args.s)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseDotenv() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseDotenv() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseDotenvRoundTrip(t *testing.T) {
+	for _, format := range []string{"shell", "dotenv"} {
+		t.Run(format, func(t *testing.T) {
+			// env vars can't hold a NUL, so shell and dotenv refuse to write one
+			b, err := formatEnvFile(trickySecretsWithout("NUL"), format, false)
+			if err != nil {
+				t.Fatalf("formatEnvFile() error = %v", err)
+			}
+			got, err := parseDotenv(string(b))
+			if err != nil {
+				t.Fatalf("parseDotenv() error = %v", err)
+			}
+			if want := trickyValues("NUL"); !reflect.DeepEqual(got, want) {
+				t.Errorf("parseDotenv() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func Test_parseSeedFile(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "seed.json")
+	err := ioutil.WriteFile(file, []byte(`{"A": "x", "PORT": 8080, "OBJ": {"k": "v"}}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := parseSeedFile(file)
+	if err != nil {
+		t.Fatalf("parseSeedFile() error = %v", err)
+	}
+	want := map[string]string{"A": "x", "PORT": "8080", "OBJ": `{"k":"v"}`}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseSeedFile() = %q, want %q", got, want)
+	}
+}
+
+func Test_seedKeys(t *testing.T) {
+	literal := "example.com"
+	data := SecretConfig{
+		SecretName: "seedapp",
+		KeyConfig: KeyConfig{
+			"DB_USER":     {Path: "secret/seed", Key: "user"},
+			"CORP_DOMAIN": {Value: &literal},
+			"API_KEY_B64": {Path: "secret/seed-api", Key: "key", Base64: true},
+		},
+		Secrets: []SecretDef{
+			{Name: "seedapp-db", KeyConfig: KeyConfig{"DB_PASS": {Path: "secret/seed", Key: "password"}}},
+		},
+	}
+	values := map[string]string{"DB_USER": "u", "DB_PASS": "p", "CORP_DOMAIN": "x", "API_KEY_B64": "k", "UNKNOWN": "?"}
+	gotKeys, gotSkipped, err := seedKeys(data, values)
+	if err != nil {
+		t.Fatalf("seedKeys() error = %v", err)
+	}
+	wantKeys := []seedKey{
+		{Path: "secret/seed", Key: "password", Var: "DB_PASS"},
+		{Path: "secret/seed", Key: "user", Var: "DB_USER"},
+	}
+	if !reflect.DeepEqual(gotKeys, wantKeys) {
+		t.Errorf("seedKeys() keys = %v, want %v", gotKeys, wantKeys)
+	}
+	wantSkipped := []string{
+		"API_KEY_B64 (transformed or composed values can't be reversed)",
+		"CORP_DOMAIN (not a vault value)",
+		"UNKNOWN (not in key_config)",
+	}
+	if !reflect.DeepEqual(gotSkipped, wantSkipped) {
+		t.Errorf("seedKeys() skipped = %v, want %v", gotSkipped, wantSkipped)
+	}
+}
+
+func Test_seedKeysUnsetEnvVar(t *testing.T) {
+	data := SecretConfig{
+		SecretName: "seedapp",
+		KeyConfig:  KeyConfig{"DB_USER": {Path: "secret/" + envVarNotFound + "/seed", Key: "user"}},
+	}
+	_, _, err := seedKeys(data, map[string]string{"DB_USER": "u"})
+	if err == nil {
+		t.Errorf("seedKeys() error = nil, want an error for a path with an unset env var")
+	}
+}
+
+func Test_groupSeedKeys(t *testing.T) {
+	type args struct {
+		keys   []seedKey
+		values map[string]string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    map[string]map[string]seedKey
+		wantErr bool
+	}{
+		{
+			name: "groupSeedKeysTest",
+			args: args{
+				keys: []seedKey{
+					{Path: "secret/a", Key: "user", Var: "A_USER"},
+					{Path: "secret/a", Key: "pass", Var: "A_PASS"},
+					{Path: "secret/b", Key: "user", Var: "B_USER"},
+				},
+				values: map[string]string{"A_USER": "1", "A_PASS": "2", "B_USER": "3"},
+			},
+			want: map[string]map[string]seedKey{
+				"secret/a": {"user": {Path: "secret/a", Key: "user", Var: "A_USER"}, "pass": {Path: "secret/a", Key: "pass", Var: "A_PASS"}},
+				"secret/b": {"user": {Path: "secret/b", Key: "user", Var: "B_USER"}},
+			},
+		},
+		{
+			name: "groupSeedKeysConflictTest",
+			args: args{
+				keys: []seedKey{
+					{Path: "secret/a", Key: "user", Var: "A_USER"},
+					{Path: "secret/a", Key: "user", Var: "OTHER_USER"},
+				},
+				values: map[string]string{"A_USER": "1", "OTHER_USER": "2"},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := groupSeedKeys(tt.args.keys, tt.args.values)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("groupSeedKeys() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("groupSeedKeys() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_formatSeedPlan(t *testing.T) {
+	writes := []seedWrite{
+		{Path: "secret/a", Version: 3, Existing: map[string]interface{}{"user": "old"}, Changes: []seedChange{
+			{Key: "pass", Var: "A_PASS", Action: "add"},
+			{Key: "user", Var: "A_USER", Action: "update"},
+		}},
+		{Path: "secret/b", Existing: map[string]interface{}{}, Changes: []seedChange{
+			{Key: "user", Var: "B_USER", Action: "add"},
+		}},
+	}
+	want := "secret/a (version 3)\n  + pass (from A_PASS)\n  ~ user (from A_USER)\nsecret/b (new)\n  + user (from B_USER)\n"
+	if got := formatSeedPlan(writes); got != want {
+		t.Errorf("formatSeedPlan() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,131 @@
+package vaulthunter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+
+	"gopkg.in/yaml.v2"
+)
+
+// folder within the vh folder holding shared map fragments - never treated as an app
+const sharedFolder = "_shared"
+
+// reference to a shared map fragment
+// params are bound to {{param}} placeholders in the fragment, {{env}} is bound to the current env unless params set it
+// keys are globs selecting which fragment keys are included, rename and prefix change the env var names they are included as
+type Include struct {
+	Name   string            `yaml:"name"`
+	Params map[string]string `yaml:"params,omitempty"`
+	Keys   []string          `yaml:"keys,omitempty"`
+	Rename map[string]string `yaml:"rename,omitempty"`
+	Prefix string            `yaml:"prefix,omitempty"`
+}
+
+type Includes []Include
+
+// allows an include to be written as just the fragment name
+func (i *Include) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name string
+	if err := unmarshal(&name); err == nil {
+		i.Name = name
+		return nil
+	}
+	type plain Include
+	return unmarshal((*plain)(i))
+}
+
+// merges all fragments included by the config into it
+// keys defined in the map take precedence over fragment keys, later fragments take precedence over earlier ones
+func resolveIncludes(folder string, env string, config SecretConfig) (SecretConfig, error) {
+	if len(config.Includes) == 0 {
+		return config, nil
+	}
+	sharedDir := filepath.Join(folder, "..", sharedFolder)
+	tdata := newTemplateData(folder, env)
+	keys := make(KeyConfig)
+	var fullPaths FullSecretConfigPaths
+	for _, x := range config.Includes {
+		if x.Name == "" {
+			return config, fmt.Errorf("include in %s is missing a fragment name", folder)
+		}
+		params := map[string]string{"env": env}
+		for k, v := range x.Params {
+			params[k] = v
+		}
+		fragment, err := parseFragment(filepath.Join(sharedDir, x.Name+".yaml"), params, tdata)
+		if err != nil {
+			return config, err
+		}
+		debugLog(fmt.Sprintf("DEBUG: including fragment %s in %s", x.Name, folder), false)
+		for k, v := range fragment.KeyConfig {
+			name, ok, err := includedKeyName(x, k)
+			if err != nil {
+				return config, err
+			}
+			if ok {
+				keys[name] = v
+			}
+		}
+		for _, y := range fragment.FullSecretConfigPaths {
+			y.layer = -1
+			y.Prefix = x.Prefix + y.Prefix
+			fullPaths = append(fullPaths, y)
+		}
+	}
+	for k, v := range config.KeyConfig {
+		keys[k] = v
+	}
+	config.KeyConfig = keys
+	// fragment paths have the lowest layer so the map's own full secret paths overwrite them
+	config.FullSecretConfigPaths = append(fullPaths, config.FullSecretConfigPaths...)
+	return config, nil
+}
+
+// env var name a fragment key is included as, false if the include's keys filter it out
+func includedKeyName(x Include, key string) (string, bool, error) {
+	if len(x.Keys) > 0 {
+		matched, err := matchesAny(x.Keys, key)
+		if err != nil || !matched {
+			return "", false, err
+		}
+	}
+	if r, ok := x.Rename[key]; ok {
+		return r, true, nil
+	}
+	return x.Prefix + key, true, nil
+}
+
+// read a shared fragment, binding params before the usual template rendering
+func parseFragment(file string, params map[string]string, tdata templateData) (fragment SecretConfig, err error) {
+	if !fileExists(file) {
+		return fragment, fmt.Errorf("could not find shared fragment: %s", file)
+	}
+	fragmentFile, err := ioutil.ReadFile(file)
+	if err != nil {
+		return fragment, fmt.Errorf("unable to read shared fragment: %s", err)
+	}
+	fragmentFile = bindParams(fragmentFile, params)
+	fragmentFile, err = renderTemplate(fragmentFile, file, tdata)
+	if err != nil {
+		return fragment, err
+	}
+	err = yaml.Unmarshal(fragmentFile, &fragment)
+	if err != nil {
+		return fragment, fmt.Errorf("unable to parse shared fragment %s: %s", file, err)
+	}
+	if len(fragment.Includes) > 0 {
+		return fragment, fmt.Errorf("shared fragment %s cannot include other fragments", file)
+	}
+	return fragment, nil
+}
+
+// replaces all {{param}} placeholders with their bound values
+func bindParams(fileBytes []byte, params map[string]string) []byte {
+	for k, v := range params {
+		re := regexp.MustCompile(`\{\{\s*` + regexp.QuoteMeta(k) + `\s*\}\}`)
+		fileBytes = re.ReplaceAllLiteral(fileBytes, []byte(v))
+	}
+	return fileBytes
+}
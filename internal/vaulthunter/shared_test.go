@@ -0,0 +1,169 @@
+package vaulthunter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_resolveIncludes(t *testing.T) {
+	type args struct {
+		folder string
+		env    string
+	}
+	tests := []struct {
+		name     string
+		args     args
+		wantData SecretConfig
+	}{
+		{
+			name: "resolveIncludesDev",
+			args: args{folder: "./../../mocks/vh/includeapp", env: "dev"},
+			wantData: SecretConfig{
+				SecretName:            "includeapp",
+				FullSecretConfigPaths: FullSecretConfigPaths{{Path: "config/machine/anotherdep/dev", layer: -1}},
+				Includes: Includes{
+					{Name: "anotherdep"},
+					{Name: "somedep", Params: map[string]string{"app": "includeapp"}},
+				},
+				KeyConfig: KeyConfig{
+					"ANOTHERDEP_SECURITY_GROUP_ID": KeyDef{
+						Path: "config/machine/anotherdep/base",
+						Key:  "ANOTHERDEP_SECURITY_GROUP_ID"},
+					"SOME_DEP_CLIENT_ID": KeyDef{
+						Path: "secret/location/one/somedep/dev/includeapp",
+						Key:  "client-id"},
+					"SOME_DEP_CLIENT_SECRET": KeyDef{
+						Path: "secret/location/one/somedep/override",
+						Key:  "client-secret"},
+				},
+			},
+		},
+		{
+			name: "resolveIncludesFromBaseProd",
+			args: args{folder: "./../../mocks/vh/includeapp/", env: "prod"},
+			wantData: SecretConfig{
+				SecretName:            "includeapp",
+				FullSecretConfigPaths: FullSecretConfigPaths{{Path: "config/machine/anotherdep/prod", layer: -1}},
+				Includes: Includes{
+					{Name: "anotherdep"},
+					{Name: "somedep", Params: map[string]string{"app": "includeapp"}},
+				},
+				KeyConfig: KeyConfig{
+					"ANOTHERDEP_SECURITY_GROUP_ID": KeyDef{
+						Path: "config/machine/anotherdep/base",
+						Key:  "ANOTHERDEP_SECURITY_GROUP_ID"},
+					"SOME_DEP_CLIENT_ID": KeyDef{
+						Path: "secret/location/one/somedep/prod/includeapp",
+						Key:  "client-id"},
+					"SOME_DEP_CLIENT_SECRET": KeyDef{
+						Path: "secret/location/one/somedep/override",
+						Key:  "client-secret"},
+					"EXAMPLE_PASS": KeyDef{
+						Path: "secret/location/one/anotherdep/prod",
+						Key:  "anotherdep-verification-token"},
+				},
+			},
+		},
+		{
+			name: "resolveIncludesPinnedEnvProd",
+			args: args{folder: "./../../mocks/vh/includepinapp", env: "prod"},
+			wantData: SecretConfig{
+				SecretName: "includepinapp",
+				Includes: Includes{
+					{
+						Name:   "somedep",
+						Params: map[string]string{"app": "includepinapp", "env": "dev"},
+						Keys:   []string{"*_ID"},
+						Rename: map[string]string{"SOME_DEP_CLIENT_ID": "REACT_APP_SOME_DEP_CLIENT_ID"},
+					},
+				},
+				KeyConfig: KeyConfig{
+					"REACT_APP_SOME_DEP_CLIENT_ID": KeyDef{
+						Path: "secret/location/one/somedep/dev/includepinapp",
+						Key:  "client-id"},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if gotData := mergeConfig(tt.args.folder, tt.args.env); !reflect.DeepEqual(gotData, tt.wantData) {
+				t.Errorf("mergeConfig() \ngot = \n%v, \nwant \n%v", gotData, tt.wantData)
+			}
+		})
+	}
+}
+
+func Test_includedKeyName(t *testing.T) {
+	type args struct {
+		x   Include
+		key string
+	}
+	tests := []struct {
+		name     string
+		args     args
+		wantName string
+		wantOk   bool
+		wantErr  bool
+	}{
+		{name: "includedKeyNameTest", args: args{x: Include{Name: "somedep"}, key: "SOME_DEP_CLIENT_ID"}, wantName: "SOME_DEP_CLIENT_ID", wantOk: true},
+		{name: "includedKeyNamePrefixTest", args: args{x: Include{Name: "somedep", Prefix: "REACT_APP_"}, key: "SOME_DEP_CLIENT_ID"}, wantName: "REACT_APP_SOME_DEP_CLIENT_ID", wantOk: true},
+		{name: "includedKeyNameRenameTest", args: args{x: Include{Name: "somedep", Prefix: "REACT_APP_", Rename: map[string]string{"SOME_DEP_AUTHORITY": "REACT_APP_SOME_DEP_DOMAIN"}}, key: "SOME_DEP_AUTHORITY"}, wantName: "REACT_APP_SOME_DEP_DOMAIN", wantOk: true},
+		{name: "includedKeyNameFilteredTest", args: args{x: Include{Name: "somedep", Keys: []string{"*_ID"}}, key: "SOME_DEP_CLIENT_SECRET"}, wantOk: false},
+		{name: "includedKeyNameInvalidGlobTest", args: args{x: Include{Name: "somedep", Keys: []string{"["}}, key: "SOME_DEP_CLIENT_ID"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotName, gotOk, err := includedKeyName(tt.args.x, tt.args.key)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("includedKeyName() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if gotName != tt.wantName || gotOk != tt.wantOk {
+				t.Errorf("includedKeyName() = %v, %v, want %v, %v", gotName, gotOk, tt.wantName, tt.wantOk)
+			}
+		})
+	}
+}
+
+func Test_parseFragment(t *testing.T) {
+	type args struct {
+		file   string
+		params map[string]string
+		tdata  templateData
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+	}{
+		{name: "parseFragmentTest", args: args{file: "./../../mocks/vh/_shared/somedep.yaml", params: map[string]string{"env": "dev"}, tdata: templateData{Env: "dev", App: "includeapp"}}, wantErr: false},
+		{name: "parseFragmentMissingTest", args: args{file: "./../../mocks/vh/_shared/nope.yaml", params: map[string]string{"env": "dev"}, tdata: templateData{Env: "dev", App: "includeapp"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseFragment(tt.args.file, tt.args.params, tt.args.tdata); (err != nil) != tt.wantErr {
+				t.Errorf("parseFragment() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_bindParams(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		params map[string]string
+		want   string
+	}{
+		{name: "bindParamsTest", input: "secrets/dep/{{env}}/{{ app }}", params: map[string]string{"env": "dev", "app": "app-two"}, want: "secrets/dep/dev/app-two"},
+		{name: "bindParamsLeavesEnvVarsTest", input: "users/{{DEV_NAME}}/{{env}}", params: map[string]string{"env": "dev"}, want: "users/{{DEV_NAME}}/dev"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(bindParams([]byte(tt.input), tt.params)); got != tt.want {
+				t.Errorf("bindParams() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package vaulthunter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// file within the vh folder declaring deployment targets per env
+const targetsFile = "targets.yaml"
+
+// namespace file mounted into pods running with a service account
+var serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// loads the in-cluster config, swapped out in tests
+var inClusterConfig = rest.InClusterConfig
+
+// a kube context and namespace secrets are written to
+// kube_context, kube_config and namespace fall back to the -kube-context, -kube-config and -namespace options
+// when no namespace is set the context's namespace is used, apps limits which apps are written
+type Target struct {
+	Name        string   `yaml:"name"`
+	KubeContext string   `yaml:"kube_context,omitempty"`
+	KubeConfig  string   `yaml:"kube_config,omitempty"`
+	Namespace   string   `yaml:"namespace,omitempty"`
+	Apps        []string `yaml:"apps,omitempty"`
+}
+
+type Targets []Target
+
+// targets.yaml contents, keyed by env
+type TargetsConfig map[string]Targets
+
+// builds a kubernetes client for a target along with the namespace to use when the target doesn't set one, swapped out in tests
+type kubeClientFactory func(t Target) (kubernetes.Interface, string, error)
+
+// reads vh/targets.yaml, a missing file is not an error
+func parseTargets(vhFolder string) (TargetsConfig, error) {
+	file := filepath.Join(vhFolder, targetsFile)
+	if !fileExists(file) {
+		return nil, nil
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read targets file: %s", err)
+	}
+	var targets TargetsConfig
+	err = yaml.Unmarshal(b, &targets)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse targets file %s: %s", file, err)
+	}
+	return targets, nil
+}
+
+// targets declared for an app in the env being processed, targets in the app's map win over targets.yaml
+func declaredTargets(c AppConfig, app string, data SecretConfig, tconfig TargetsConfig) Targets {
+	if len(data.Targets) > 0 {
+		return data.Targets
+	}
+	var targets Targets
+	for _, x := range tconfig[c.configEnv] {
+		if len(x.Apps) == 0 || containsString(x.Apps, app) {
+			targets = append(targets, x)
+		}
+	}
+	return targets
+}
+
+// targets an app's secrets are written to for the env being processed
+// targets in the app's map win over targets.yaml, when neither declares any the -kube-config/-namespace options are used
+func appTargets(c AppConfig, app string, data SecretConfig, tconfig TargetsConfig) Targets {
+	targets := declaredTargets(c, app, data, tconfig)
+	if len(targets) == 0 {
+		targets = Targets{{Name: "default"}}
+	}
+	var resolved Targets
+	for _, x := range targets {
+		if x.KubeConfig == "" {
+			x.KubeConfig = c.kubeConfig
+		}
+		if x.KubeContext == "" {
+			x.KubeContext = c.kubeContext
+		}
+		if x.Namespace == "" {
+			x.Namespace = c.kubeNamespace
+		}
+		if x.Name == "" {
+			x.Name = strings.Trim(x.KubeContext+"/"+x.Namespace, "/")
+		}
+		if x.Name == "" {
+			x.Name = "default"
+		}
+		resolved = append(resolved, x)
+	}
+	return resolved
+}
+
+// builds a clientset for the target, along with the namespace of its context
+func getTargetClientset(t Target) (kubernetes.Interface, string, error) {
+	config, namespace, err := getTargetConfig(t)
+	if err != nil {
+		return nil, "", err
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, "", err
+	}
+	return clientset, namespace, nil
+}
+
+// rest config and namespace for a target
+// uses the target's kubeconfig and context, the kubeconfig's current context is used when unset
+// when no kubeconfig or context is given and a service account is mounted, the in-cluster config and the pod's namespace are used
+func getTargetConfig(t Target) (*rest.Config, string, error) {
+	if t.KubeConfig == "" && t.KubeContext == "" && fileExists(serviceAccountNamespaceFile) {
+		debugLog("DEBUG: no kubeconfig set, using in-cluster config", false)
+		config, err := inClusterConfig()
+		if err != nil {
+			return nil, "", fmt.Errorf("unable to load in-cluster config: %s", err)
+		}
+		namespace, err := ioutil.ReadFile(serviceAccountNamespaceFile)
+		if err != nil {
+			return nil, "", fmt.Errorf("unable to read service account namespace: %s", err)
+		}
+		log.Printf("INFO: target %s: using the in-cluster config", t.Name)
+		return config, strings.TrimSpace(string(namespace)), nil
+	}
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = t.KubeConfig
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: t.KubeContext}
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+	config, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, "", err
+	}
+	context := t.KubeContext
+	if context == "" {
+		raw, err := clientConfig.RawConfig()
+		if err != nil {
+			return nil, "", err
+		}
+		context = raw.CurrentContext
+	}
+	log.Printf("INFO: target %s: using kube context %s", t.Name, context)
+	// defaults to "default" when the context has no namespace
+	namespace, _, err := clientConfig.Namespace()
+	if err != nil {
+		return nil, "", err
+	}
+	return config, namespace, nil
+}
+
+// writes all of an app's resolved secrets to a single target
+func writeTargetSecrets(c AppConfig, t Target, clients kubeClientFactory, resolved []resolvedSecret) error {
+	clientset, namespace, err := clients(t)
+	if err != nil {
+		return fmt.Errorf("unable to get kube client: %s", err)
+	}
+	// no namespace from the target or -namespace, fall back to the context's, which is "default" when it sets none
+	if t.Namespace == "" {
+		t.Namespace = namespace
+		if namespace == "default" {
+			log.Printf("WARN: target %s: no namespace set by the target, -namespace or the kube context, writing to namespace default", t.Name)
+		} else {
+			log.Printf("INFO: target %s: no namespace set, using namespace %s from the kube context", t.Name, namespace)
+		}
+	}
+	secretsClient := clientset.CoreV1().Secrets(t.Namespace)
+	configMapsClient := clientset.CoreV1().ConfigMaps(t.Namespace)
+	for _, s := range resolved {
+		secretName := k8sSecretName(c, s.Name)
+		secrets := s.Values
+		if c.splitConfigMap {
+			var configValues map[string]interface{}
+			secrets, configValues = splitNonSecrets(s.Keys, secrets)
+			// a secret with only vault backed keys gets no configmap
+			if len(configValues) > 0 {
+				err = createAppEnvConfigMap(configMapsClient, secretName, configValues)
+				if err != nil {
+					return err
+				}
+				log.Printf("created or updated configmap: %s", secretName)
+			}
+		}
+		changed, err := createAppEnvConfigSecret(secretsClient, secretName, s.Type, secrets)
+		if err != nil {
+			return err
+		}
+		log.Printf("created or updated secret: %s", secretName)
+		if changed && c.restartOnChange {
+			restarted, err := restartWorkloads(clientset, t.Namespace, secretName)
+			if err != nil {
+				return err
+			}
+			for _, w := range restarted {
+				log.Printf("INFO: secret %s changed, restarted %s", secretName, w)
+			}
+		}
+	}
+	log.Printf("INFO: target %s: wrote %d secret(s) to namespace %s", t.Name, len(resolved), t.Namespace)
+	return nil
+}
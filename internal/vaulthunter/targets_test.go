@@ -0,0 +1,242 @@
+package vaulthunter
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+)
+
+// factory returning the same client for every target
+func staticClients(k kubernetes.Interface) kubeClientFactory {
+	return func(Target) (kubernetes.Interface, string, error) {
+		return k, "default", nil
+	}
+}
+
+// factory returning a client per kube context, unknown contexts are an error
+func contextClients(clients map[string]kubernetes.Interface) kubeClientFactory {
+	return func(t Target) (kubernetes.Interface, string, error) {
+		k, ok := clients[t.KubeContext]
+		if !ok {
+			return nil, "", fmt.Errorf("context %s does not exist", t.KubeContext)
+		}
+		return k, "default", nil
+	}
+}
+
+func Test_parseTargets(t *testing.T) {
+	tests := []struct {
+		name     string
+		vhFolder string
+		wantEnvs int
+		wantErr  bool
+	}{
+		{name: "parseTargetsTest", vhFolder: "./../../mocks/vh", wantEnvs: 1},
+		{name: "parseTargetsMissingTest", vhFolder: "./../../mocks/policies", wantEnvs: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTargets(tt.vhFolder)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseTargets() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if len(got) != tt.wantEnvs {
+				t.Errorf("parseTargets() = %v, want %d envs", got, tt.wantEnvs)
+			}
+		})
+	}
+}
+
+func Test_appTargets(t *testing.T) {
+	tconfig := TargetsConfig{
+		"staging": {
+			{Name: "cluster-a-api", KubeContext: "cluster-a", Namespace: "api", Apps: []string{"app-two-api"}},
+			{Name: "cluster-b", KubeContext: "cluster-b"},
+		},
+	}
+	type args struct {
+		c    AppConfig
+		app  string
+		data SecretConfig
+	}
+	tests := []struct {
+		name string
+		args args
+		want Targets
+	}{
+		{
+			name: "appTargetsFilteredTest",
+			args: args{c: AppConfig{configEnv: "staging", kubeConfig: "kc", kubeNamespace: "ns"}, app: "app-two-client"},
+			want: Targets{{Name: "cluster-b", KubeContext: "cluster-b", KubeConfig: "kc", Namespace: "ns"}},
+		},
+		{
+			name: "appTargetsMapTest",
+			args: args{c: AppConfig{configEnv: "staging"}, app: "app-two-api", data: SecretConfig{Targets: Targets{{KubeContext: "prod-east", Namespace: "api"}}}},
+			want: Targets{{Name: "prod-east/api", KubeContext: "prod-east", Namespace: "api"}},
+		},
+		{
+			name: "appTargetsDefaultTest",
+			args: args{c: AppConfig{configEnv: "dev", kubeConfig: "kc", kubeNamespace: "ns"}, app: "app-two-api"},
+			want: Targets{{Name: "default", KubeConfig: "kc", Namespace: "ns"}},
+		},
+		{
+			name: "appTargetsKubeContextTest",
+			args: args{c: AppConfig{configEnv: "dev", kubeContext: "dev-storage"}, app: "app-two-api"},
+			want: Targets{{Name: "default", KubeContext: "dev-storage"}},
+		},
+		{
+			name: "appTargetsNoNamespaceTest",
+			args: args{c: AppConfig{configEnv: "staging", kubeContext: "dev-storage"}, app: "app-two-client"},
+			want: Targets{{Name: "cluster-b", KubeContext: "cluster-b"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := appTargets(tt.args.c, tt.args.app, tt.args.data, tconfig); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("appTargets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_createSecretsTargets(t *testing.T) {
+	type target struct {
+		context   string
+		namespace string
+		want      bool
+	}
+	tests := []struct {
+		name    string
+		env     string
+		targets []target
+		wantErr bool
+	}{
+		{
+			name: "createSecretsTargetsFileTest",
+			env:  "staging",
+			targets: []target{
+				{context: "cluster-a", namespace: "api", want: true},
+				{context: "cluster-b", namespace: "shared", want: true},
+				{context: "cluster-a", namespace: "other", want: false},
+			},
+		},
+		{
+			name: "createSecretsTargetsMapTest",
+			env:  "prod",
+			targets: []target{
+				{context: "prod-east", namespace: "targetapp", want: true},
+			},
+			// prod-west has no client, the other target is still written
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clients := make(map[string]kubernetes.Interface)
+			for _, x := range tt.targets {
+				if clients[x.context] == nil {
+					clients[x.context] = fake.NewSimpleClientset()
+				}
+			}
+			c := AppConfig{vhFolder: "./../../mocks/vh", configEnv: tt.env, apps: []string{"targetapp"}}
+			err := createSecrets(c, nil, contextClients(clients))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("createSecrets() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for _, x := range tt.targets {
+				secret, err := clients[x.context].CoreV1().Secrets(x.namespace).Get(context.TODO(), "targetapp", metav1.GetOptions{})
+				if (err == nil) != x.want {
+					t.Errorf("secret in %s/%s exists = %v, want %v", x.context, x.namespace, err == nil, x.want)
+					continue
+				}
+				if x.want && string(secret.Data["APP_ENV"]) != tt.env {
+					t.Errorf("secret in %s/%s APP_ENV = %s, want %s", x.context, x.namespace, secret.Data["APP_ENV"], tt.env)
+				}
+			}
+		})
+	}
+}
+
+func Test_getTargetConfig(t *testing.T) {
+	defer func(f string, c func() (*rest.Config, error)) {
+		serviceAccountNamespaceFile = f
+		inClusterConfig = c
+	}(serviceAccountNamespaceFile, inClusterConfig)
+	saDir := t.TempDir()
+	saNamespaceFile := filepath.Join(saDir, "namespace")
+	err := ioutil.WriteFile(saNamespaceFile, []byte("in-cluster-ns\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name          string
+		target        Target
+		saFile        string
+		wantHost      string
+		wantNamespace string
+		wantErr       bool
+	}{
+		{
+			name:          "getTargetConfigCurrentContextTest",
+			target:        Target{KubeConfig: "./../../mocks/kubeconfig"},
+			saFile:        saNamespaceFile,
+			wantHost:      "https://1.2.3.4",
+			wantNamespace: "frontend",
+		},
+		{
+			name:          "getTargetConfigKubeContextTest",
+			target:        Target{KubeConfig: "./../../mocks/kubeconfig", KubeContext: "dev-storage"},
+			wantHost:      "https://1.2.3.4",
+			wantNamespace: "storage",
+		},
+		{
+			name:          "getTargetConfigDefaultNamespaceTest",
+			target:        Target{KubeConfig: "./../../mocks/kubeconfig", KubeContext: "dev-no-namespace"},
+			wantHost:      "https://1.2.3.4",
+			wantNamespace: "default",
+		},
+		{
+			name:    "getTargetConfigMissingContextTest",
+			target:  Target{KubeConfig: "./../../mocks/kubeconfig", KubeContext: "nope"},
+			wantErr: true,
+		},
+		{
+			name:          "getTargetConfigInClusterTest",
+			target:        Target{},
+			saFile:        saNamespaceFile,
+			wantHost:      "https://10.0.0.1:443",
+			wantNamespace: "in-cluster-ns",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serviceAccountNamespaceFile = filepath.Join(saDir, "missing")
+			if tt.saFile != "" {
+				serviceAccountNamespaceFile = tt.saFile
+			}
+			inClusterConfig = func() (*rest.Config, error) {
+				return &rest.Config{Host: "https://10.0.0.1:443"}, nil
+			}
+			got, gotNamespace, err := getTargetConfig(tt.target)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("getTargetConfig() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Host != tt.wantHost || gotNamespace != tt.wantNamespace {
+				t.Errorf("getTargetConfig() = %v, %v, want %v, %v", got.Host, gotNamespace, tt.wantHost, tt.wantNamespace)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package vaulthunter
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// value substituted for env vars which could not be looked up
+// generated policies replace path segments containing it with "+"
+const envVarNotFound = "ENV_VAR_NOT_FOUND"
+
+// built-in values available to templates in secret maps and secret values
+type templateData struct {
+	Env string
+	App string
+}
+
+// matches the legacy {{ENV_VAR}} syntax
+var legacyVarRe = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// template actions which must not be rewritten as legacy env var lookups
+var templateKeywords = map[string]bool{
+	"if": true, "else": true, "end": true, "range": true, "with": true, "define": true, "block": true,
+	"template": true, "break": true, "continue": true, "nil": true, "true": true, "false": true,
+}
+
+// template data for an app folder and env
+func newTemplateData(folder string, env string) templateData {
+	return templateData{
+		Env: env,
+		App: filepath.Base(filepath.Clean(folder)),
+	}
+}
+
+// built-in template functions, missing collects env vars that could not be looked up
+// input and value belong to "template" transforms, which run after the map is rendered, so maps leave them in place
+func templateFuncs(missing *[]string) template.FuncMap {
+	return template.FuncMap{
+		"input": func(name string) string {
+			return fmt.Sprintf("{{ input %q }}", name)
+		},
+		"value": func() string {
+			return "{{ value }}"
+		},
+		"env": func(name string) string {
+			v, exist := os.LookupEnv(name)
+			if !exist {
+				*missing = append(*missing, name)
+				return envVarNotFound
+			}
+			return v
+		},
+		"default": func(def interface{}, val interface{}) interface{} {
+			if isEmptyTemplateValue(val) {
+				return def
+			}
+			return val
+		},
+		"required": func(msg string, val interface{}) (interface{}, error) {
+			if isEmptyTemplateValue(val) {
+				return nil, fmt.Errorf("%s", msg)
+			}
+			return val, nil
+		},
+	}
+}
+
+// true for nil, empty strings and unresolved env vars
+func isEmptyTemplateValue(val interface{}) bool {
+	if val == nil {
+		return true
+	}
+	s := fmt.Sprintf("%v", val)
+	return s == "" || s == envVarNotFound
+}
+
+// replaces legacy {{ENV_VAR}} placeholders in a value read from vault, as values always have been
+// values are never run as templates, so any other {{ }} text is kept as stored
+func substituteEnvVars(s string, stringIdentifier string) string {
+	if !strings.Contains(s, "{{") {
+		return s
+	}
+	var missing []string
+	s = legacyVarRe.ReplaceAllStringFunc(s, func(m string) string {
+		name := legacyVarRe.FindStringSubmatch(m)[1]
+		v, exist := os.LookupEnv(name)
+		if !exist {
+			missing = append(missing, name)
+			return envVarNotFound
+		}
+		return v
+	})
+	if len(missing) > 0 {
+		log.Printf("WARN: unable to lookup env var(s) %s passed in string: %s", strings.Join(missing, ", "), stringIdentifier)
+	}
+	return s
+}
+
+// renders the provided bytes as a go template, stringIdentifier used for logging and errors
+// legacy {{ENV_VAR}} placeholders are rewritten to {{ env "ENV_VAR" }} before rendering
+func renderTemplate(fileBytes []byte, stringIdentifier string, data templateData) ([]byte, error) {
+	if !bytes.Contains(fileBytes, []byte("{{")) {
+		return fileBytes, nil
+	}
+	var missing []string
+	funcs := templateFuncs(&missing)
+	src := legacyVarRe.ReplaceAllStringFunc(string(fileBytes), func(m string) string {
+		name := legacyVarRe.FindStringSubmatch(m)[1]
+		if _, ok := funcs[name]; ok || templateKeywords[name] {
+			return m
+		}
+		return fmt.Sprintf("{{ env %q }}", name)
+	})
+	tmpl, err := template.New(stringIdentifier).Funcs(funcs).Option("missingkey=error").Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse template in %s: %s", stringIdentifier, err)
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to render template in %s: %s", stringIdentifier, err)
+	}
+	rendered := buf.Bytes()
+	if len(missing) > 0 && bytes.Contains(rendered, []byte(envVarNotFound)) {
+		log.Printf("WARN: unable to lookup env var(s) %s passed in string: %s", strings.Join(missing, ", "), stringIdentifier)
+	}
+	return rendered, nil
+}
@@ -0,0 +1,109 @@
+package vaulthunter
+
+import (
+	"os"
+	"testing"
+)
+
+func Test_renderTemplate(t *testing.T) {
+	type args struct {
+		fileBytes []byte
+		data      templateData
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "renderTemplateBuiltins",
+			args:    args{fileBytes: []byte("config/{{ .App }}/{{ .Env }}"), data: templateData{Env: "dev", App: "app-one"}},
+			want:    "config/app-one/dev",
+			wantErr: false,
+		},
+		{
+			name:    "renderTemplateEnvFunc",
+			args:    args{fileBytes: []byte(`users/{{ env "VH_TEST_DEV_NAME" }}/db`), data: templateData{}},
+			want:    "users/trex/db",
+			wantErr: false,
+		},
+		{
+			name:    "renderTemplateLegacyEnvVar",
+			args:    args{fileBytes: []byte("users/{{VH_TEST_DEV_NAME}}/db/{{ VH_TEST_DEV_NAME }}"), data: templateData{}},
+			want:    "users/trex/db/trex",
+			wantErr: false,
+		},
+		{
+			name:    "renderTemplateLegacyMissingEnvVar",
+			args:    args{fileBytes: []byte("users/{{VH_TEST_MISSING}}/db"), data: templateData{}},
+			want:    "users/ENV_VAR_NOT_FOUND/db",
+			wantErr: false,
+		},
+		{
+			name:    "renderTemplateDefault",
+			args:    args{fileBytes: []byte(`users/{{ env "VH_TEST_MISSING" | default "bob" }}/{{ env "VH_TEST_DEV_NAME" | default "bob" }}`), data: templateData{}},
+			want:    "users/bob/trex",
+			wantErr: false,
+		},
+		{
+			name:    "renderTemplateRequired",
+			args:    args{fileBytes: []byte(`users/{{ env "VH_TEST_DEV_NAME" | required "VH_TEST_DEV_NAME must be set" }}`), data: templateData{}},
+			want:    "users/trex",
+			wantErr: false,
+		},
+		{
+			name:    "renderTemplateRequiredMissing",
+			args:    args{fileBytes: []byte(`users/{{ env "VH_TEST_MISSING" | required "VH_TEST_MISSING must be set" }}`), data: templateData{}},
+			wantErr: true,
+		},
+		{
+			name:    "renderTemplateUnknownField",
+			args:    args{fileBytes: []byte(`users/{{ .Nope }}`), data: templateData{}},
+			wantErr: true,
+		},
+		{
+			name:    "renderTemplateLeavesTransformFuncs",
+			args:    args{fileBytes: []byte(`template: mysql://{{ input "user" }}@{{ value }}/{{ .Env }}`), data: templateData{Env: "dev"}},
+			want:    `template: mysql://{{ input "user" }}@{{ value }}/dev`,
+			wantErr: false,
+		},
+		{
+			name:    "renderTemplateNoTemplate",
+			args:    args{fileBytes: []byte("plain } value {"), data: templateData{}},
+			want:    "plain } value {",
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv("VH_TEST_DEV_NAME", "trex")
+			got, err := renderTemplate(tt.args.fileBytes, tt.name, tt.args.data)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("renderTemplate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && string(got) != tt.want {
+				t.Errorf("renderTemplate() = %v, want %v", string(got), tt.want)
+			}
+		})
+	}
+}
+
+func Test_newTemplateData(t *testing.T) {
+	tests := []struct {
+		name   string
+		folder string
+		env    string
+		want   templateData
+	}{
+		{name: "newTemplateDataTest", folder: "./../../mocks/vh/includeapp/", env: "prod", want: templateData{Env: "prod", App: "includeapp"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newTemplateData(tt.folder, tt.env); got != tt.want {
+				t.Errorf("newTemplateData() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
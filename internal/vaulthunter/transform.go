@@ -0,0 +1,183 @@
+package vaulthunter
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// single step of a key's transform pipeline, written in a map as either "name" or "name: arg"
+type TransformStep struct {
+	Name string
+	Arg  string
+}
+
+// ordered transform pipeline applied to a key's value
+type Transforms []TransformStep
+
+// transforms which require an argument
+var transformArgs = map[string]bool{
+	"base64":       false,
+	"base64decode": false,
+	"hex":          false,
+	"trim":         false,
+	"upper":        false,
+	"lower":        false,
+	"json":         true,
+	"template":     true,
+}
+
+// allows a step to be written as a plain name or as a single "name: arg" object
+func (t *TransformStep) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name string
+	if err := unmarshal(&name); err == nil {
+		t.Name = name
+		return nil
+	}
+	var m map[string]string
+	if err := unmarshal(&m); err != nil {
+		return err
+	}
+	if len(m) != 1 {
+		return fmt.Errorf("transform step must have exactly one name, got: %v", m)
+	}
+	for k, v := range m {
+		t.Name = k
+		t.Arg = v
+	}
+	return nil
+}
+
+// make sure all steps are known and have their required args
+func validateTransforms(steps Transforms) error {
+	for _, x := range steps {
+		needsArg, ok := transformArgs[x.Name]
+		if !ok {
+			return fmt.Errorf("unknown transform: %s", x.Name)
+		}
+		if needsArg && x.Arg == "" {
+			return fmt.Errorf("transform %s requires an argument", x.Name)
+		}
+	}
+	return nil
+}
+
+// run value through each transform step in order
+// inputs are the resolved values of the key's named inputs, available to "template" steps
+func applyTransforms(value string, steps Transforms, inputs map[string]string) (string, error) {
+	err := validateTransforms(steps)
+	if err != nil {
+		return "", err
+	}
+	for _, x := range steps {
+		switch x.Name {
+		case "base64":
+			value = base64.StdEncoding.EncodeToString([]byte(value))
+		case "base64decode":
+			b, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				return "", fmt.Errorf("unable to base64 decode value: %s", err)
+			}
+			value = string(b)
+		case "hex":
+			value = hex.EncodeToString([]byte(value))
+		case "trim":
+			if x.Arg != "" {
+				value = strings.Trim(value, x.Arg)
+			} else {
+				value = strings.TrimSpace(value)
+			}
+		case "upper":
+			value = strings.ToUpper(value)
+		case "lower":
+			value = strings.ToLower(value)
+		case "json":
+			value, err = extractJSONPath(value, x.Arg)
+			if err != nil {
+				return "", err
+			}
+		case "template":
+			value, err = composeTemplate(x.Arg, value, inputs)
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+	return value, nil
+}
+
+// renders tmpl as a go template with the map template functions, {{ input "name" }} is a named input and {{ value }} the current value
+func composeTemplate(tmpl string, value string, inputs map[string]string) (string, error) {
+	var missing []string
+	funcs := templateFuncs(&missing)
+	funcs["input"] = func(name string) (string, error) {
+		v, ok := inputs[name]
+		if !ok {
+			return "", fmt.Errorf("undefined input %s", name)
+		}
+		return v, nil
+	}
+	funcs["value"] = func() string {
+		return value
+	}
+	t, err := template.New("template").Funcs(funcs).Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse template transform: %s", err)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, nil); err != nil {
+		return "", fmt.Errorf("unable to render template transform: %s", err)
+	}
+	return buf.String(), nil
+}
+
+// pulls a single field out of a json value, path is dot separated, ex. ".database.hosts[0]"
+func extractJSONPath(value string, path string) (string, error) {
+	var obj interface{}
+	d := json.NewDecoder(bytes.NewReader([]byte(value)))
+	d.UseNumber()
+	if err := d.Decode(&obj); err != nil {
+		return "", fmt.Errorf("value is not valid json: %s", err)
+	}
+	path = strings.ReplaceAll(path, "[", ".")
+	path = strings.ReplaceAll(path, "]", "")
+	for _, x := range strings.Split(strings.Trim(path, "."), ".") {
+		if x == "" {
+			continue
+		}
+		switch o := obj.(type) {
+		case map[string]interface{}:
+			v, ok := o[x]
+			if !ok {
+				return "", fmt.Errorf("json path %s not found: missing %s", path, x)
+			}
+			obj = v
+		case []interface{}:
+			i, err := strconv.Atoi(x)
+			if err != nil || i < 0 || i >= len(o) {
+				return "", fmt.Errorf("json path %s not found: invalid index %s", path, x)
+			}
+			obj = o[i]
+		default:
+			return "", fmt.Errorf("json path %s not found: %s is not an object or array", path, x)
+		}
+	}
+	return secretValueString(obj), nil
+}
+
+// string form of a value read from vault, objects and arrays are returned as json
+func secretValueString(v interface{}) string {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		b, err := json.Marshal(v)
+		if err == nil {
+			return string(b)
+		}
+	}
+	return fmt.Sprintf("%v", v)
+}
@@ -0,0 +1,99 @@
+package vaulthunter
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func Test_applyTransforms(t *testing.T) {
+	type args struct {
+		value  string
+		steps  Transforms
+		inputs map[string]string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    string
+		wantErr bool
+	}{
+		{name: "base64Test", args: args{value: "imadirtysecret", steps: Transforms{{Name: "base64"}}}, want: "aW1hZGlydHlzZWNyZXQ=", wantErr: false},
+		{name: "base64DecodeTest", args: args{value: "aW1hZGlydHlzZWNyZXQ=", steps: Transforms{{Name: "base64decode"}}}, want: "imadirtysecret", wantErr: false},
+		{name: "base64DecodeInvalidTest", args: args{value: "not base64!", steps: Transforms{{Name: "base64decode"}}}, wantErr: true},
+		{name: "hexTest", args: args{value: "cat", steps: Transforms{{Name: "hex"}}}, want: "636174", wantErr: false},
+		{name: "trimUpperTest", args: args{value: "  kitty\n", steps: Transforms{{Name: "trim"}, {Name: "upper"}}}, want: "KITTY", wantErr: false},
+		{name: "trimCutsetLowerTest", args: args{value: "/KITTY/", steps: Transforms{{Name: "trim", Arg: "/"}, {Name: "lower"}}}, want: "kitty", wantErr: false},
+		{name: "jsonTest", args: args{value: `{"primary":{"hosts":["db-1","db-2"],"port":3306}}`, steps: Transforms{{Name: "json", Arg: ".primary.hosts[1]"}}}, want: "db-2", wantErr: false},
+		{name: "jsonNumberTest", args: args{value: `{"primary":{"port":3306}}`, steps: Transforms{{Name: "json", Arg: "primary.port"}}}, want: "3306", wantErr: false},
+		{name: "jsonObjectTest", args: args{value: `{"primary":{"port":3306}}`, steps: Transforms{{Name: "json", Arg: "primary"}}}, want: `{"port":3306}`, wantErr: false},
+		{name: "jsonMissingTest", args: args{value: `{"primary":{}}`, steps: Transforms{{Name: "json", Arg: "primary.host"}}}, wantErr: true},
+		{
+			name: "templateTest",
+			args: args{
+				value:  "db",
+				steps:  Transforms{{Name: "template", Arg: `mysql://{{ input "user" }}:{{ input "pass" }}@{{ value }}/app?cost=${5}`}},
+				inputs: map[string]string{"user": "bob", "pass": "hunter2"},
+			},
+			want:    "mysql://bob:hunter2@db/app?cost=${5}",
+			wantErr: false,
+		},
+		{
+			name: "templateFuncsTest",
+			args: args{
+				value:  "db",
+				steps:  Transforms{{Name: "template", Arg: `{{ input "user" | default "nobody" }}@{{ value }}`}},
+				inputs: map[string]string{"user": ""},
+			},
+			want:    "nobody@db",
+			wantErr: false,
+		},
+		{name: "templateMissingInputTest", args: args{steps: Transforms{{Name: "template", Arg: `{{ input "user" }}`}}}, wantErr: true},
+		{name: "templateInvalidTest", args: args{steps: Transforms{{Name: "template", Arg: `{{ input "user" `}}}, wantErr: true},
+		{name: "unknownTransformTest", args: args{value: "cat", steps: Transforms{{Name: "rot13"}}}, wantErr: true},
+		{name: "missingArgTest", args: args{value: "{}", steps: Transforms{{Name: "json"}}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyTransforms(tt.args.value, tt.args.steps, tt.args.inputs)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("applyTransforms() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("applyTransforms() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_TransformStep_UnmarshalYAML(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    Transforms
+		wantErr bool
+	}{
+		{name: "unmarshalTransformsTest", input: "- trim\n- json: .a.b\n", want: Transforms{{Name: "trim"}, {Name: "json", Arg: ".a.b"}}, wantErr: false},
+		{name: "unmarshalTransformsMultipleKeysTest", input: "- json: .a\n  trim: x\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Transforms
+			err := yaml.Unmarshal([]byte(tt.input), &got)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("UnmarshalYAML() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && len(got) != len(tt.want) {
+				t.Errorf("UnmarshalYAML() = %v, want %v", got, tt.want)
+				return
+			}
+			for x := range tt.want {
+				if got[x] != tt.want[x] {
+					t.Errorf("UnmarshalYAML() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -10,8 +10,8 @@ import (
 	"log"
 	"os"
 	"regexp"
-	"sort"
 	"strings"
+	"time"
 
 	vapi "github.com/hashicorp/vault/api"
 	vaws "github.com/hashicorp/vault/api/auth/aws"
@@ -19,28 +19,53 @@ import (
 	apiv1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
 	v1 "k8s.io/client-go/kubernetes/typed/core/v1"
-	"k8s.io/client-go/tools/clientcmd"
 )
 
 // path and key vault secret
+// inputs are additional named vault values which can be composed into the value with a "template" transform
+// value (a literal) or from_env (an env var name) can be used instead of path/key for non-secret config
 type KeyDef struct {
-	Path   string `yaml:"path"`
-	Key    string `yaml:"key"`
-	Base64 bool   `yaml:"base64,omitempty"`
+	Path      string            `yaml:"path"`
+	Key       string            `yaml:"key"`
+	Base64    bool              `yaml:"base64,omitempty"`
+	Inputs    map[string]KeyDef `yaml:"inputs,omitempty"`
+	Transform Transforms        `yaml:"transform,omitempty"`
+	Value     *string           `yaml:"value,omitempty"`
+	FromEnv   string            `yaml:"from_env,omitempty"`
+	Raw       bool              `yaml:"raw,omitempty"`
 }
 
 // map of vault secret locations
 type KeyConfig map[string]KeyDef
 
-type FullSecretConfigPaths []string
+// true if the key's value, and the value of all its inputs, never comes from vault
+func (k KeyDef) nonSecret() bool {
+	if k.Value == nil && k.FromEnv == "" {
+		return false
+	}
+	for _, x := range k.Inputs {
+		if !x.nonSecret() {
+			return false
+		}
+	}
+	return true
+}
 
 // secret config object
 type SecretConfig struct {
 	SecretName            string                `yaml:"secret_name"`
 	KeyConfig             KeyConfig             `yaml:"key_config"`
 	FullSecretConfigPaths FullSecretConfigPaths `yaml:"full_secret_config_paths"`
+	Includes              Includes              `yaml:"include,omitempty"`
+	Secrets               []SecretDef           `yaml:"secrets,omitempty"`
+	Targets               Targets               `yaml:"targets,omitempty"`
+	Templates             Templates             `yaml:"templates,omitempty"`
+	ProjectID             string                `yaml:"project_id,omitempty"`
+	CIProvider            string                `yaml:"ci_provider,omitempty"`
+	ServiceAccounts       ServiceAccounts       `yaml:"service_accounts,omitempty"`
+	JWTMount              string                `yaml:"jwt_mount,omitempty"`
+	Policy                *PolicyOptions        `yaml:"policy,omitempty"`
 }
 
 // configuration for vault-hunter
@@ -48,10 +73,12 @@ type AppConfig struct {
 	configEnv            string
 	displayHelp          bool
 	envFileDirectory     string
+	format               string
 	vaultHost            string
 	vaultToken           string
 	vhFolder             string
 	kubeConfig           string
+	kubeContext          string
 	kubeNamespace        string
 	vconfig              *vapi.Config
 	verifyConfig         bool
@@ -62,9 +89,30 @@ type AppConfig struct {
 	projectID            string
 	applyConfig          bool
 	policyPrefix         string
+	policyScope          string
+	ciProvider           string
+	roleTypes            string
+	jwtMount             string
+	kubernetesMount      string
 	policyLockProdClaims bool
 	dependencyApps       string
 	removeExport         bool
+	restartOnChange      bool
+	workloads            string
+	app                  string
+	watch                time.Duration
+	args                 []string
+	seedFrom             string
+	seedWrite            bool
+	rotatePath           string
+	rotateKey            string
+	rotateValue          string
+	rotateGenerate       bool
+	rotateLength         int
+	rotateCharset        string
+	secretNames          []string
+	output               string
+	splitConfigMap       bool
 }
 
 var debug bool
@@ -77,6 +125,12 @@ func Cli() {
 	helpCmd := flag.NewFlagSet("help", flag.ExitOnError)
 	generateEnvFileCmd := flag.NewFlagSet("generate-env-file", flag.ExitOnError)
 	generateAllPoliciesCmd := flag.NewFlagSet("generate-policies", flag.ExitOnError)
+	annotateCmd := flag.NewFlagSet("annotate", flag.ExitOnError)
+	execCmd := flag.NewFlagSet("exec", flag.ExitOnError)
+	seedCmd := flag.NewFlagSet("seed", flag.ExitOnError)
+	rotateCmd := flag.NewFlagSet("rotate", flag.ExitOnError)
+	whoUsesCmd := flag.NewFlagSet("who-uses", flag.ExitOnError)
+	graphCmd := flag.NewFlagSet("graph", flag.ExitOnError)
 
 	if len(os.Args) <= 1 {
 		help()
@@ -91,7 +145,9 @@ func Cli() {
 		if err != nil {
 			log.Fatal(err)
 		}
-		checkEmpty("appname", c.appName)
+		if c.policyScope != "per-app" {
+			checkEmpty("appname", c.appName)
+		}
 		checkEmpty("vh-folder", c.vhFolder)
 		client, err := getVaultClient(c.vconfig, c.vaultToken)
 		if err != nil {
@@ -113,18 +169,167 @@ func Cli() {
 		checkEmpty("env", c.configEnv)
 		checkEmpty("vault-url", c.vaultHost)
 		checkEmpty("vault-token", c.vaultToken)
-		checkEmpty("kube-config", c.kubeConfig)
-		checkEmpty("namespace", c.kubeNamespace)
 		checkEmpty("vh-folder", c.vhFolder)
 		vclient, err := getVaultClient(c.vconfig, c.vaultToken)
 		if err != nil {
 			log.Fatal(err)
 		}
-		kclient, err := getKubeClient(c.kubeConfig, c.kubeNamespace)
+		err = createSecrets(c, vclient, getTargetClientset)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "annotate":
+		c := parseFlags(annotateCmd)
+		c, err := parseVhFolder(c)
+		if err != nil {
+			log.Fatal(err)
+		}
+		checkEmpty("env", c.configEnv)
+		checkEmpty("vault-url", c.vaultHost)
+		checkEmpty("workload", c.workloads)
+		checkEmpty("vh-folder", c.vhFolder)
+		vclient, err := getVaultClient(c.vconfig, c.vaultToken)
+		if err != nil {
+			log.Fatal(err)
+		}
+		kclient, namespace, err := getTargetClientset(Target{KubeConfig: c.kubeConfig, KubeContext: c.kubeContext})
 		if err != nil {
 			log.Fatalf("unable to get kube client: %s", err)
 		}
-		createSecrets(c, vclient, kclient)
+		if c.kubeNamespace != "" {
+			namespace = c.kubeNamespace
+		}
+		hashes, err := secretHashes(c, vclient, namespace)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = annotateWorkloads(kclient.AppsV1(), namespace, strings.Split(c.workloads, ","), hashes)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "exec":
+		c := parseFlags(execCmd)
+		c, err := parseVhFolder(c)
+		if err != nil {
+			log.Fatal(err)
+		}
+		checkEmpty("env", c.configEnv)
+		checkEmpty("vh-folder", c.vhFolder)
+		if len(c.args) == 0 {
+			log.Fatal("ERROR: missing command to run, ex. vault-hunter exec -env local -app app-one -- go run ./...")
+		}
+		app, err := execApp(c)
+		if err != nil {
+			log.Fatal(err)
+		}
+		client, err := getVaultClient(c.vconfig, c.vaultToken)
+		if err != nil {
+			log.Fatal(err)
+		}
+		code, err := runWithSecrets(c.args, appSecretLookup(client, c.vhFolder+"/"+app, c.configEnv), c.watch)
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(code)
+	case "seed":
+		c := parseFlags(seedCmd)
+		c, err := parseVhFolder(c)
+		if err != nil {
+			log.Fatal(err)
+		}
+		checkEmpty("env", c.configEnv)
+		checkEmpty("from", c.seedFrom)
+		checkEmpty("vault-url", c.vaultHost)
+		checkEmpty("vh-folder", c.vhFolder)
+		values, err := parseSeedFile(c.seedFrom)
+		if err != nil {
+			log.Fatal(err)
+		}
+		client, err := getVaultClient(c.vconfig, c.vaultToken)
+		if err != nil {
+			log.Fatal(err)
+		}
+		writes, err := seedSecrets(c, client, values)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Print(formatSeedPlan(writes))
+		if !c.seedWrite {
+			log.Print("INFO: dry run, pass -write to write these values to vault")
+		} else if err := applySeed(client, writes); err != nil {
+			log.Fatal(err)
+		}
+	case "rotate":
+		c := parseFlags(rotateCmd)
+		c, err := parseVhFolder(c)
+		if err != nil {
+			log.Fatal(err)
+		}
+		checkEmpty("path", c.rotatePath)
+		checkEmpty("key", c.rotateKey)
+		checkEmpty("vault-url", c.vaultHost)
+		checkEmpty("vh-folder", c.vhFolder)
+		value, err := rotateValue(c)
+		if err != nil {
+			log.Fatal(err)
+		}
+		client, err := getVaultClient(c.vconfig, c.vaultToken)
+		if err != nil {
+			log.Fatal(err)
+		}
+		results, err := rotateSecret(c, client, getTargetClientset, value)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Print(formatRotateSummary(results))
+		for _, x := range results {
+			if strings.HasPrefix(x.Status, "failed") {
+				os.Exit(1)
+			}
+		}
+	case "who-uses":
+		query := popPositionalArg()
+		c := parseFlags(whoUsesCmd)
+		c, err := parseVhFolder(c)
+		if err != nil {
+			log.Fatal(err)
+		}
+		checkEmpty("vh-folder", c.vhFolder)
+		if query == "" && len(c.args) > 0 {
+			query = c.args[0]
+		}
+		p, key, err := parseWhoUsesQuery(query)
+		if err != nil {
+			log.Fatal(err)
+		}
+		refs, err := whoUses(c, p, key)
+		if err != nil {
+			log.Fatal(err)
+		}
+		out, err := formatWhoUses(refs, c.output)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Print(out)
+	case "graph":
+		c := parseFlags(graphCmd)
+		c, err := parseVhFolder(c)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if c.policyScope != "per-app" {
+			checkEmpty("appname", c.appName)
+		}
+		checkEmpty("vh-folder", c.vhFolder)
+		g, err := buildGraph(c)
+		if err != nil {
+			log.Fatal(err)
+		}
+		out, err := formatGraph(g, c.format)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Print(out)
 	case "generate-env-file":
 		c := parseFlags(generateEnvFileCmd)
 		c, err := parseVhFolder(c)
@@ -134,21 +339,16 @@ func Cli() {
 		checkEmpty("env", c.configEnv)
 		checkEmpty("vh-folder", c.vhFolder)
 		checkEmpty("env-file-dir", c.envFileDirectory)
+		if c.format == "" {
+			c.format = "shell"
+		}
 		client, err := getVaultClient(c.vconfig, c.vaultToken)
 		if err != nil {
 			log.Fatal(err)
 		}
-		for _, x := range c.apps {
-			appFolder := c.vhFolder + "/" + x
-			_, secrets, err := getSecrets(client, appFolder, c.configEnv)
-			if err != nil {
-				log.Fatal(err)
-			}
-			filename := c.envFileDirectory + "/" + x + "-" + c.configEnv + ".env"
-			err = writeEnvFile(secrets, filename, c.removeExport)
-			if err != nil {
-				log.Fatal(err)
-			}
+		err = generateEnvFiles(c, client)
+		if err != nil {
+			log.Fatal(err)
 		}
 		os.Exit(0)
 	case "generate-policies":
@@ -157,9 +357,19 @@ func Cli() {
 		if err != nil {
 			log.Fatal(err)
 		}
-		checkEmpty("appname", c.appName)
+		roleTypes, err := parseRoleTypes(c.roleTypes)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// per-app policies are named after each app and bound to its own project_id
+		if c.policyScope != "per-app" {
+			checkEmpty("appname", c.appName)
+			// kubernetes roles are bound to service accounts rather than a ci project
+			if containsString(roleTypes, "jwt") {
+				checkEmpty("project-id", c.projectID)
+			}
+		}
 		checkEmpty("vh-folder", c.vhFolder)
-		checkEmpty("project-id", c.projectID)
 		client, err := getVaultClient(c.vconfig, c.vaultToken)
 		if err != nil {
 			log.Fatal(err)
@@ -176,6 +386,16 @@ func Cli() {
 	}
 }
 
+// removes and returns the argument following the command when it isn't a flag, so flags can come after it
+func popPositionalArg() string {
+	if len(os.Args) <= 2 || strings.HasPrefix(os.Args[2], "-") {
+		return ""
+	}
+	arg := os.Args[2]
+	os.Args = append(os.Args[:2], os.Args[3:]...)
+	return arg
+}
+
 // checks if key is empty
 func checkEmpty(key string, val string) bool {
 	if val == "" {
@@ -190,20 +410,41 @@ func parseFlags(f *flag.FlagSet) (config AppConfig) {
 	debugPtr := f.Bool("debug", false, "display debug logging")
 	configEnvPtr := f.String("env", "", "name of the config environment, i.e. name of the 'environment.yaml' file within 'vh-folder'. Can also set with VH_ENV env var")
 	vhFolderPtr := f.String("vh-folder", "vh", "folder of secret map yaml files. Can also set with VH_CONFIG_DIR env var - defaults to 'vh'")
-	envFileDirectoryPtr := f.String("env-file-dir", ".", "directory for placing .env files when calling \"generate-env-file\"")
+	envFileDirectoryPtr := f.String("env-file-dir", ".", "directory for placing .env files when calling \"generate-env-file\", '-' writes to stdout")
+	formatPtr := f.String("format", "", "requires 'generate-env-file' or 'graph', format of env files - shell (default), dotenv, docker, json, yaml, properties or tfvars - or of the graph - dot (default), mermaid or json")
 	vaultHostPtr := f.String("vault-url", "", "vault url. Can also set with VAULT_ADDR env var")
 	vaultTokenPtr := f.String("vault-token", "", "vault token. Can also set with VAULT_TOKEN env var")
 	kubeConfigPtr := f.String("kube-config", "", "location of kubectl config. Can also set with KUBECONFIG env var")
-	kubeNamespacePtr := f.String("namespace", "", "kubernetes namespace to place secret. Can also set with KUBE_NAMESPACE env var")
+	kubeContextPtr := f.String("kube-context", "", "kubeconfig context to use when a target doesn't set one - defaults to the current context")
+	kubeNamespacePtr := f.String("namespace", "", "kubernetes namespace to place secret when a target doesn't set one - defaults to the context's namespace. Can also set with KUBE_NAMESPACE env var")
 	secretNamePrefixPtr := f.String("secret-name-prefix", "", "prefix for the kubernetes secret(s).")
 	secretNameSuffixPtr := f.String("secret-name-suffix", "", "suffix for the kubernetes secret(s).")
-	projectIDPtr := f.String("project-id", "", "gitlab projectID for application - needed for 'generate-policies'")
-	policyLockProdClaimsPtr := f.Bool("policy-lock-prod-claims", true, "when generating policies, lock prod env to the master branch. Defaults true")
+	projectIDPtr := f.String("project-id", "", "gitlab projectID, or github owner/repo, for application - needed for 'generate-policies'")
+	roleTypesPtr := f.String("role-type", "jwt", "requires 'generate-policies' or 'delete', comma separated role types to generate - jwt for ci, kubernetes for the service_accounts declared in maps")
+	jwtMountPtr := f.String("jwt-mount", "jwt", "requires 'generate-policies' or 'delete', auth mount jwt roles are written to, ex. gitlab for auth/gitlab. Maps can set their own with jwt_mount in per-app scope")
+	kubernetesMountPtr := f.String("kubernetes-mount", "kubernetes", "requires 'generate-policies' or 'delete', auth mount kubernetes roles are written to")
+	ciProviderPtr := f.String("ci-provider", "gitlab", "requires 'generate-policies', ci system generated roles accept jwts from - gitlab or github. Maps can set their own with ci_provider in per-app scope")
+	policyLockProdClaimsPtr := f.Bool("policy-lock-prod-claims", true, "deprecated - protected envs are configured under 'protected' in vh/roles.yaml, false is the same as 'protected: []'")
 	policyPrefixPtr := f.String("policy-prefix", "vh", "prefix for all generated vault policies and roles - defaults to 'vh'")
+	policyScopePtr := f.String("policy-scope", "combined", "'combined' generates one <prefix>-<appname>-<env> policy and role covering every app, 'per-app' generates <prefix>-<app>-<env> ones for each app folder, bound to the app's project_id")
 	verifyPtr := f.Bool("verify", false, "set to true to only verify secrets defined in secmap exist in vault")
 	applyConfigPtr := f.Bool("apply", false, "set to true to apply generated policies and roles to vault")
 	dependencyAppsPtr := f.String("dependent-apps", "", "comma separated list of additional application names to add to created role for access via CI")
 	removeExportPtr := f.Bool("remove-export", false, "set to remove export string from generated env file")
+	splitConfigMapPtr := f.Bool("split-configmap", false, "requires 'create', places non-secret values (value/from_env keys) into a configmap named after the secret instead of the secret")
+	restartOnChangePtr := f.Bool("restart-on-change", false, "requires 'create', restarts deployments, statefulsets and daemonsets using a secret when its content changes")
+	workloadsPtr := f.String("workload", "", "requires 'annotate', comma separated workloads to annotate with a checksum of the secrets, ex. deploy/app-one,sts/app-two")
+	appPtr := f.String("app", "", "requires 'exec', 'seed' or 'annotate', app to run the command with, seed or annotate - 'exec' defaults to the only app in 'vh-folder', 'seed' and 'annotate' to all apps")
+	seedFromPtr := f.String("from", "", "requires 'seed', dotenv or .json file of values to write to vault")
+	seedWritePtr := f.Bool("write", false, "requires 'seed', writes the values to vault instead of only showing what would change")
+	watchPtr := f.Duration("watch", 0, "requires 'exec', interval to look up secrets again on, restarting the command when they change, ex. 1m")
+	rotatePathPtr := f.String("path", "", "requires 'rotate', vault path of the value to rotate, ex. secrets/rabbitmq/prod/app-one")
+	rotateKeyPtr := f.String("key", "", "requires 'rotate', key within 'path' to rotate")
+	rotateValuePtr := f.String("value", "", "requires 'rotate', new value for the key")
+	rotateGeneratePtr := f.Bool("generate", false, "requires 'rotate', generates a random value for the key instead of using 'value'")
+	rotateLengthPtr := f.Int("length", 32, "requires 'rotate', length of generated values")
+	rotateCharsetPtr := f.String("charset", "", "requires 'rotate', characters generated values are made of - defaults to letters and digits")
+	outputPtr := f.String("output", "table", "requires 'who-uses', output format - table or json")
 	displayHelpPtr := f.Bool("help", false, "display vault-hunter help")
 
 	f.Parse(os.Args[2:])
@@ -212,27 +453,49 @@ func parseFlags(f *flag.FlagSet) (config AppConfig) {
 	config.configEnv = *configEnvPtr
 	config.vhFolder = setVar("VH_CONFIG_DIR", vhFolderPtr)
 	config.envFileDirectory = *envFileDirectoryPtr
+	config.format = *formatPtr
 	config.vaultHost = setVar("VAULT_ADDR", vaultHostPtr)
 	config.vaultToken = setVar("VAULT_TOKEN", vaultTokenPtr)
 	config.kubeConfig = setVar("KUBECONFIG", kubeConfigPtr)
+	config.kubeContext = *kubeContextPtr
 	config.kubeNamespace = setVar("KUBE_NAMESPACE", kubeNamespacePtr)
 	config.secretNamePrefix = *secretNamePrefixPtr
 	config.secretNameSuffix = *secretNameSuffixPtr
 	config.projectID = *projectIDPtr
+	config.ciProvider = *ciProviderPtr
+	config.roleTypes = *roleTypesPtr
+	config.jwtMount = *jwtMountPtr
+	config.kubernetesMount = *kubernetesMountPtr
 	config.verifyConfig = *verifyPtr
 	config.applyConfig = *applyConfigPtr
 	config.displayHelp = *displayHelpPtr
 	config.policyLockProdClaims = *policyLockProdClaimsPtr
 	config.policyPrefix = *policyPrefixPtr
+	config.policyScope = *policyScopePtr
 	config.dependencyApps = *dependencyAppsPtr
 	config.removeExport = *removeExportPtr
+	config.splitConfigMap = *splitConfigMapPtr
+	config.restartOnChange = *restartOnChangePtr
+	config.workloads = *workloadsPtr
+	config.app = *appPtr
+	config.watch = *watchPtr
+	config.args = f.Args()
+	config.seedFrom = *seedFromPtr
+	config.seedWrite = *seedWritePtr
+	config.rotatePath = *rotatePathPtr
+	config.rotateKey = *rotateKeyPtr
+	config.rotateValue = *rotateValuePtr
+	config.rotateGenerate = *rotateGeneratePtr
+	config.rotateLength = *rotateLengthPtr
+	config.rotateCharset = *rotateCharsetPtr
+	config.output = *outputPtr
 	config.vconfig = &vapi.Config{
 		Address: config.vaultHost,
 	}
 	return config
 }
 
-// find all non "generated" folders in vh folder, assume they are a maps folder for an app
+// find all non "generated" and non shared folders in vh folder, assume they are a maps folder for an app
 func parseVhFolder(aConfig AppConfig) (appConfig AppConfig, err error) {
 	dirList, err := ioutil.ReadDir(aConfig.vhFolder)
 	if err != nil {
@@ -240,7 +503,7 @@ func parseVhFolder(aConfig AppConfig) (appConfig AppConfig, err error) {
 	}
 	var apps []string
 	for _, f := range dirList {
-		if f.IsDir() && f.Name() != "generated" {
+		if f.IsDir() && f.Name() != "generated" && f.Name() != sharedFolder {
 			str := "adding " + f.Name() + " to app list..."
 			debugLog(str, false)
 			apps = append(apps, f.Name())
@@ -250,31 +513,44 @@ func parseVhFolder(aConfig AppConfig) (appConfig AppConfig, err error) {
 	return aConfig, nil
 }
 
-// translates sec map from vault, creates k8s secret
-func createSecrets(c AppConfig, vclient *vapi.Client, secretsClient v1.SecretInterface) {
+// translates sec map from vault, creates k8s secrets in each of the app's targets
+// secrets are looked up once per app, a failing target doesn't stop the remaining targets from being written
+func createSecrets(c AppConfig, vclient *vapi.Client, clients kubeClientFactory) error {
+	tconfig, err := parseTargets(c.vhFolder)
+	if err != nil {
+		return err
+	}
+	var failed []string
 	debugLog("DEBUG: starting vault lookup...", false)
 	for _, x := range c.apps {
 		appFolder := c.vhFolder + "/" + x
-		secretName, secrets, err := getSecrets(vclient, appFolder, c.configEnv)
+		data := mergeConfig(appFolder, c.configEnv)
+		resolved, err := resolveSecrets(vclient, data)
 		if err != nil {
-			log.Fatalf("error getting secrets: %s", err)
+			return fmt.Errorf("error getting secrets: %s", err)
 		}
-		if c.secretNamePrefix != "" {
-			secretName = c.secretNamePrefix + "-" + secretName
-		}
-		if c.secretNameSuffix != "" {
-			secretName = secretName + "-" + c.secretNameSuffix
+		resolved, err = addTemplateSecrets(appFolder, data, resolved)
+		if err != nil {
+			return fmt.Errorf("error rendering templates: %s", err)
 		}
+		resolved = filterSecrets(resolved, c.secretNames)
 		debugLog("DEBUG: secret lookup successful", false)
 		// don't create secret if in verify mode
-		if !c.verifyConfig {
-			err = createAppEnvConfigSecret(secretsClient, secretName, secrets)
+		if c.verifyConfig {
+			continue
+		}
+		for _, t := range appTargets(c, x, data, tconfig) {
+			err := writeTargetSecrets(c, t, clients, resolved)
 			if err != nil {
-				log.Fatal(err)
+				log.Printf("ERROR: target %s (%s): %s", t.Name, x, err)
+				failed = append(failed, t.Name+" ("+x+")")
 			}
-			log.Printf("created or updated secret: %s", secretName)
 		}
 	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to write secrets to target(s): %s", strings.Join(failed, ", "))
+	}
+	return nil
 }
 
 // modified secret path to be kv2 compatabile (puts /data/ after store)
@@ -286,84 +562,136 @@ func modSecretPath(p string) string {
 	return lookupPath
 }
 
-// pull secrets from vault
+// converts a secret path to its kv v2 metadata path, used for listing
+func modMetadataPath(p string) string {
+	re := regexp.MustCompile(`^[^/]*`)
+	store := re.FindString(p)
+	return store + strings.Replace(p, store, "/metadata", 1)
+}
+
+// pull secrets from vault, values from all of the map's secrets are combined
 func getSecrets(client *vapi.Client, folder string, env string) (string, map[string]interface{}, error) {
+	data, err := loadConfig(folder, env)
+	if err != nil {
+		return "", nil, err
+	}
+	resolved, err := resolveSecrets(client, data)
+	if err != nil {
+		return "", nil, err
+	}
+	secrets, err := combineSecrets(resolved)
+	if err != nil {
+		return "", nil, err
+	}
+	return data.SecretName, secrets, nil
+}
+
+// pull secrets from vault for an already merged secret map
+func getSecretsFromConfig(client *vapi.Client, data SecretConfig) (string, map[string]interface{}, error) {
 	var secrets = make(map[string]interface{})
 	var secretName string
-	data := mergeConfig(folder, env)
 
 	secretName = data.SecretName
 	// process any full secret config paths - grabs all k/v from secret
-	if data.FullSecretConfigPaths != nil {
-		for _, x := range data.FullSecretConfigPaths {
-			lookupPath := modSecretPath(x)
-			secret, err := getSecret(lookupPath, client)
-			if err != nil {
-				return "", nil, err
-			}
-			m := secret.Data
-			if secret.Data["data"] != nil {
-				objects, ok := secret.Data["data"].(map[string]interface{})
-				// throw error if the lookupKey doesn't exist in the secrets object
-				if objects == nil {
-					log.Print(objects)
-					return "", nil, fmt.Errorf("secret %s returned empty - make sure key for exists in vault", lookupPath)
-				}
-				if !ok {
-					return "", nil, fmt.Errorf("could not decode v2 secret")
-				}
-				m = objects
-			}
-			// grab all objects from secret, uppercase key and set as env var
-			for k, v := range m {
-				str := fmt.Sprintf("%v", v)
-				upperKey := strings.ToUpper(k)
-				// find and replace any env vars in secret value
-				byteStr := []byte(str)
-				finalSecretVal, err := resolveEnvVarsInString(byteStr, str)
-				if err != nil {
-					return "", nil, err
-				}
-				secrets[upperKey] = string(finalSecretVal)
-			}
-		}
+	fullSecrets, err := getFullSecrets(client, data.FullSecretConfigPaths)
+	if err != nil {
+		return "", nil, err
 	}
+	for k, v := range fullSecrets {
+		secrets[k] = v
+	}
+	cache := make(secretCache)
 	for k, v := range data.KeyConfig {
-		lookupPath := modSecretPath(v.Path)
-		lookupKey := v.Key
-		secret, err := getSecret(lookupPath, client)
+		finalSecretVal, err := resolveKeyDef(client, cache, k, v)
 		if err != nil {
 			return "", nil, err
 		}
-		m := secret.Data
-		// check if secret was pulled from kv-v2 and grab key from correct object
-		if secret.Data["data"] != nil {
-			objects, ok := secret.Data["data"].(map[string]interface{})
-			// throw error if the lookupKey doesn't exist in the secrets object
-			if objects[lookupKey] == nil {
-				return "", nil, fmt.Errorf("key %s returned nil for secret %s - make sure key for exists in vault", lookupKey, lookupPath)
-			}
-			if !ok {
-				return "", nil, fmt.Errorf("could not decode v2 secret")
-			}
-			m = objects
+		secrets[k] = finalSecretVal
+		if debug {
+			log.Printf("DEBUG: pulled secret: %s - %s/%s", k, v.Path, v.Key)
 		}
-		str := fmt.Sprintf("%v", m[lookupKey])
-		// find and replace any env vars in secret value
-		byteStr := []byte(str)
-		finalSecretVal, err := resolveEnvVarsInString(byteStr, str)
+	}
+	return secretName, secrets, nil
+}
+
+// resolve a single key_config entry - looks up its vault value and inputs, then runs its transforms
+func resolveKeyDef(client *vapi.Client, cache secretCache, name string, v KeyDef) (string, error) {
+	var value string
+	if (v.Value != nil || v.FromEnv != "") && v.Path != "" {
+		return "", fmt.Errorf("key %s can only define one of value, from_env or path", name)
+	}
+	switch {
+	case v.Value != nil:
+		value = *v.Value
+	case v.FromEnv != "":
+		val, exist := os.LookupEnv(v.FromEnv)
+		if !exist {
+			return "", fmt.Errorf("env var %s for key %s is not set", v.FromEnv, name)
+		}
+		value = val
+	case v.Path != "":
+		val, err := lookupSecretValue(client, cache, v.Path, v.Key, v.Raw)
 		if err != nil {
-			return "", nil, err
+			return "", err
 		}
-		if v.Base64 {
-			finalSecretVal = []byte(base64.StdEncoding.EncodeToString((finalSecretVal)))
+		value = val
+	case len(v.Inputs) == 0:
+		return "", fmt.Errorf("key %s must define a path, value, from_env or inputs", name)
+	}
+	inputs := make(map[string]string)
+	for x, input := range v.Inputs {
+		val, err := resolveKeyDef(client, cache, name+"."+x, input)
+		if err != nil {
+			return "", err
 		}
-		secrets[k] = string(finalSecretVal)
-		if debug {
-			log.Printf("DEBUG: pulled secret: %s - %s/%s", k, lookupPath, lookupKey)
+		inputs[x] = val
+	}
+	value, err := applyTransforms(value, v.Transform, inputs)
+	if err != nil {
+		return "", fmt.Errorf("unable to transform key %s: %s", name, err)
+	}
+	if v.Base64 {
+		value = base64.StdEncoding.EncodeToString([]byte(value))
+	}
+	return value, nil
+}
+
+// secrets read while resolving a map, keyed by lookup path so keys and inputs sharing a path read it once
+type secretCache map[string]*vapi.Secret
+
+// look up a single key from a vault secret, legacy {{ENV_VAR}} placeholders in the value are substituted unless raw is set
+func lookupSecretValue(client *vapi.Client, cache secretCache, path string, lookupKey string, raw bool) (string, error) {
+	lookupPath := modSecretPath(path)
+	secret, ok := cache[lookupPath]
+	if !ok {
+		var err error
+		secret, err = getSecret(lookupPath, client)
+		if err != nil {
+			return "", err
 		}
+		cache[lookupPath] = secret
 	}
-	return secretName, secrets, nil
+	if isDeletedVersion(secret) {
+		return "", fmt.Errorf("secret %s is deleted - restore it in vault or remove key %s", lookupPath, lookupKey)
+	}
+	m := secret.Data
+	// check if secret was pulled from kv-v2 and grab key from correct object
+	if secret.Data["data"] != nil {
+		objects, ok := secret.Data["data"].(map[string]interface{})
+		// throw error if the lookupKey doesn't exist in the secrets object
+		if objects[lookupKey] == nil {
+			return "", fmt.Errorf("key %s returned nil for secret %s - make sure key for exists in vault", lookupKey, lookupPath)
+		}
+		if !ok {
+			return "", fmt.Errorf("could not decode v2 secret")
+		}
+		m = objects
+	}
+	value := secretValueString(m[lookupKey])
+	if raw {
+		return value, nil
+	}
+	return substituteEnvVars(value, lookupPath+"/"+lookupKey), nil
 }
 
 func getSecret(lookupPath string, client *vapi.Client) (secret *vapi.Secret, err error) {
@@ -385,86 +713,162 @@ func getSecret(lookupPath string, client *vapi.Client) (secret *vapi.Secret, err
 	return secret, nil
 }
 
-// return k8s client
-func getKubeClient(kconfig string, namespace string) (v1.SecretInterface, error) {
-	config, err := clientcmd.BuildConfigFromFlags("", kconfig)
-	if err != nil {
-		return nil, err
-	}
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		return nil, err
-	}
-
-	secretClient := clientset.CoreV1().Secrets(namespace)
-	return secretClient, nil
+// true for a deleted or destroyed kv v2 version, which reads back with metadata but no data
+func isDeletedVersion(secret *vapi.Secret) bool {
+	_, isV2 := secret.Data["metadata"]
+	return isV2 && secret.Data["data"] == nil
 }
 
-// create k8s secret
-func createAppEnvConfigSecret(secretsClient v1.SecretInterface, secretName string, env map[string]interface{}) error {
+// create k8s secret, secretType defaults to Opaque
+// returns true when an existing secret's content was changed
+func createAppEnvConfigSecret(secretsClient v1.SecretInterface, secretName string, secretType string, env map[string]interface{}) (bool, error) {
 	ctx := context.TODO()
 	createOpts := metav1.CreateOptions{}
 	updateOpts := metav1.UpdateOptions{}
 	newSecret := new(apiv1.Secret)
 	newSecret.Name = secretName
-	newSecret.Type = apiv1.SecretTypeOpaque
-	newSecret.Data = make(map[string][]byte)
-	for k, v := range env {
-		newSecret.Data[k] = []byte(fmt.Sprintf("%v", v))
-	}
+	newSecret.Type = k8sSecretType(secretType)
+	newSecret.Data = k8sSecretData(env)
+	hash := secretContentHash(newSecret.Type, newSecret.Data)
+	newSecret.Annotations = map[string]string{secretHashAnnotation: hash}
 	if _, err := secretsClient.Create(ctx, newSecret, createOpts); err != nil {
 		if apierrors.IsAlreadyExists(err) {
 			log.Print("secret already exists, updating...")
+			existing, err := secretsClient.Get(ctx, secretName, metav1.GetOptions{})
+			if err != nil {
+				return false, fmt.Errorf("unable to get existing secret %s", err)
+			}
+			previous := existing.Annotations[secretHashAnnotation]
+			if previous == "" {
+				previous = secretContentHash(existing.Type, existing.Data)
+			}
+			// keep annotations set by others
+			for k, v := range existing.Annotations {
+				if k != secretHashAnnotation {
+					newSecret.Annotations[k] = v
+				}
+			}
 			if _, err = secretsClient.Update(ctx, newSecret, updateOpts); err != nil {
-				return fmt.Errorf("unable to update existing secret %s", err)
+				return false, fmt.Errorf("unable to update existing secret %s", err)
+			}
+			return previous != hash, nil
+		}
+		return false, fmt.Errorf("unable to create secret %s", err)
+	}
+	return false, nil
+}
+
+// k8s secret type, defaults to Opaque
+func k8sSecretType(secretType string) apiv1.SecretType {
+	if secretType == "" {
+		return apiv1.SecretTypeOpaque
+	}
+	return apiv1.SecretType(secretType)
+}
+
+// k8s secret data for a map of secret values
+func k8sSecretData(env map[string]interface{}) map[string][]byte {
+	data := make(map[string][]byte)
+	for k, v := range env {
+		data[k] = []byte(fmt.Sprintf("%v", v))
+	}
+	return data
+}
+
+// k8s secret name with the -secret-name-prefix/-secret-name-suffix options applied
+func k8sSecretName(c AppConfig, secretName string) string {
+	if c.secretNamePrefix != "" {
+		secretName = c.secretNamePrefix + "-" + secretName
+	}
+	if c.secretNameSuffix != "" {
+		secretName = secretName + "-" + c.secretNameSuffix
+	}
+	return secretName
+}
+
+// moves the values of non-secret keys out of the secrets map
+func splitNonSecrets(keys KeyConfig, secrets map[string]interface{}) (secretValues map[string]interface{}, configValues map[string]interface{}) {
+	secretValues = make(map[string]interface{})
+	configValues = make(map[string]interface{})
+	for k, v := range secrets {
+		if keys[k].nonSecret() {
+			configValues[k] = v
+		} else {
+			secretValues[k] = v
+		}
+	}
+	return secretValues, configValues
+}
+
+// create k8s configmap
+func createAppEnvConfigMap(configMapsClient v1.ConfigMapInterface, configMapName string, env map[string]interface{}) error {
+	ctx := context.TODO()
+	createOpts := metav1.CreateOptions{}
+	updateOpts := metav1.UpdateOptions{}
+	newConfigMap := new(apiv1.ConfigMap)
+	newConfigMap.Name = configMapName
+	newConfigMap.Data = make(map[string]string)
+	for k, v := range env {
+		newConfigMap.Data[k] = fmt.Sprintf("%v", v)
+	}
+	if _, err := configMapsClient.Create(ctx, newConfigMap, createOpts); err != nil {
+		if apierrors.IsAlreadyExists(err) {
+			log.Print("configmap already exists, updating...")
+			if _, err = configMapsClient.Update(ctx, newConfigMap, updateOpts); err != nil {
+				return fmt.Errorf("unable to update existing configmap %s", err)
 			}
 			return nil
 		}
-		return fmt.Errorf("unable to create secret %s", err)
+		return fmt.Errorf("unable to create configmap %s", err)
 	}
 	return nil
 }
 
 // read secmap and unmarshall it into struct
-func parseSecretConfig(file string) (data SecretConfig) {
+func parseSecretConfig(file string, tdata templateData) (data SecretConfig) {
+	data, err := readSecretConfig(file, tdata)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return data
+}
+
+// read secmap and unmarshall it into struct, returning any error instead of exiting
+func readSecretConfig(file string, tdata templateData) (data SecretConfig, err error) {
 	yamlFile, err := ioutil.ReadFile(file)
 	if err != nil {
-		log.Fatalf("unable to read secret map file: %s", err)
+		return data, fmt.Errorf("unable to read secret map file: %s", err)
 	}
-	// replace any dynamic env vars
-	yamlFile, err = resolveEnvVarsInString(yamlFile, file)
+	// render any templates and dynamic env vars
+	yamlFile, err = renderTemplate(yamlFile, file, tdata)
 	if err != nil {
-		log.Fatalf("could not lookup env var: %s in map file: %s", err, file)
+		return data, fmt.Errorf("could not render map file: %s", err)
 	}
 	err = yaml.Unmarshal(yamlFile, &data)
 	if err != nil {
-		log.Fatal(err)
+		return data, fmt.Errorf("unable to parse secret map file %s: %s", file, err)
 	}
 	if debug {
 		log.Printf("DEBUG: parsed data from secret map: %v", data)
 	}
 
-	return data
+	return data, nil
 }
 
 // replaces all {{ENV_VARS}} vars in provided string, stringIdentifier used for logging purposes
 func resolveEnvVarsInString(fileBytes []byte, stringIdentifier string) (fullFile []byte, err error) {
-	fileStr := string(fileBytes)
-	re := regexp.MustCompile(`\{\{(.*?)\}\}`)
-	submatchall := re.FindAllString(fileStr, -1)
-	for _, envVar := range submatchall {
-		trimmedEnvVar := strings.Trim(envVar, "{")
-		trimmedEnvVar = strings.Trim(trimmedEnvVar, "}")
-		v, exist := os.LookupEnv(trimmedEnvVar)
-		if exist {
-			fileStr = strings.ReplaceAll(fileStr, envVar, v)
-		} else {
-			fileStr = strings.ReplaceAll(fileStr, envVar, "ENV_VAR_NOT_FOUND")
-			log.Printf("WARN: unable to lookup env var %s passed in string: %s", trimmedEnvVar, stringIdentifier)
-		}
+	return renderTemplate(fileBytes, stringIdentifier, templateData{})
+}
+
+// apps a command runs for, -app limits them to one
+func selectedApps(c AppConfig) ([]string, error) {
+	if c.app == "" {
+		return c.apps, nil
+	}
+	if !containsString(c.apps, c.app) {
+		return nil, fmt.Errorf("app %s not found in %s", c.app, c.vhFolder)
 	}
-	fullFile = []byte(fileStr)
-	return fullFile, nil
+	return []string{c.app}, nil
 }
 
 // check if file exists
@@ -503,22 +907,38 @@ func getVaultClient(clientConfig *vapi.Config, token string) (client *vapi.Clien
 
 // merges env and base config files
 func mergeConfig(folder string, env string) (data SecretConfig) {
+	data, err := loadConfig(folder, env)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return data
+}
+
+// merges env and base config files, returning any error instead of exiting
+func loadConfig(folder string, env string) (SecretConfig, error) {
 	var mergedConfig SecretConfig
 	baseFile := folder + "/base.yaml"
 	if !fileExists(baseFile) {
 		baseFile = folder + "/dev.yaml"
 	}
 	if !fileExists(baseFile) {
-		log.Fatalf("could not find basefile (base.yaml or dev.yaml): %s", baseFile)
+		return mergedConfig, fmt.Errorf("could not find basefile (base.yaml or dev.yaml): %s", baseFile)
 	}
 	envFile := folder + "/" + env + ".yaml"
 	if !fileExists(envFile) {
 		log.Printf("WARN: could not find %s env in folder %s, falling back to basefile: %s", env, folder, baseFile)
 		envFile = baseFile
 	}
-	envConfig := parseSecretConfig(envFile)
+	tdata := newTemplateData(folder, env)
+	envConfig, err := readSecretConfig(envFile, tdata)
+	if err != nil {
+		return mergedConfig, err
+	}
 	if fileExists(baseFile) && baseFile != envFile {
-		baseConfig := parseSecretConfig(baseFile)
+		baseConfig, err := readSecretConfig(baseFile, tdata)
+		if err != nil {
+			return mergedConfig, err
+		}
 		b, err := json.Marshal(baseConfig)
 		if err != nil {
 			log.Panic(err)
@@ -528,14 +948,35 @@ func mergeConfig(folder string, env string) (data SecretConfig) {
 		}
 		mergedConfig = baseConfig
 		mergedConfig.SecretName = envConfig.SecretName
-		// fullSecretPaths are appended from the env requested which will be processed last
-		// as long as we can depend on the order of this array, the secrets will resolve/merge properly
-		if mergedConfig.FullSecretConfigPaths == nil {
-			mergedConfig.FullSecretConfigPaths = envConfig.FullSecretConfigPaths
-		} else {
-			mergedConfig.FullSecretConfigPaths = append(mergedConfig.FullSecretConfigPaths, envConfig.FullSecretConfigPaths...)
+		// fullSecretPaths from the env requested take precedence over the base paths when they set the same key
+		for _, x := range envConfig.FullSecretConfigPaths {
+			x.layer = 1
+			mergedConfig.FullSecretConfigPaths = append(mergedConfig.FullSecretConfigPaths, x)
+		}
+		debugLog(fmt.Sprintf("DEBUG: mergedConfig.FullSecretConfigPaths = %v", mergedConfig.FullSecretConfigPaths), false)
+		mergedConfig.Includes = append(mergedConfig.Includes, envConfig.Includes...)
+		mergedConfig.Secrets = mergeSecretDefs(baseConfig.Secrets, envConfig.Secrets)
+		mergedConfig.Templates = mergeTemplates(baseConfig.Templates, envConfig.Templates)
+		if envConfig.ProjectID != "" {
+			mergedConfig.ProjectID = envConfig.ProjectID
+		}
+		if envConfig.CIProvider != "" {
+			mergedConfig.CIProvider = envConfig.CIProvider
+		}
+		if envConfig.JWTMount != "" {
+			mergedConfig.JWTMount = envConfig.JWTMount
+		}
+		// targets are not merged, the env's targets replace any base targets
+		if len(envConfig.Targets) > 0 {
+			mergedConfig.Targets = envConfig.Targets
+		}
+		// same for service accounts
+		if len(envConfig.ServiceAccounts) > 0 {
+			mergedConfig.ServiceAccounts = envConfig.ServiceAccounts
+		}
+		if envConfig.Policy != nil {
+			mergedConfig.Policy = envConfig.Policy
 		}
-		debugLog(fmt.Sprintf("DEBUG: mergedConfig.FullSecretConfigPaths = %s", mergedConfig.FullSecretConfigPaths), false)
 
 		for x := range envConfig.KeyConfig {
 			if mergedConfig.KeyConfig == nil {
@@ -548,6 +989,10 @@ func mergeConfig(folder string, env string) (data SecretConfig) {
 	} else {
 		mergedConfig = envConfig
 	}
+	mergedConfig, err = resolveIncludes(folder, env, mergedConfig)
+	if err != nil {
+		return mergedConfig, fmt.Errorf("unable to resolve includes for %s: %s", folder, err)
+	}
 
 	if debug {
 		ec, err := json.Marshal(envConfig)
@@ -561,7 +1006,7 @@ func mergeConfig(folder string, env string) (data SecretConfig) {
 		log.Printf("DEBUG: envConfig:\n %s\n", ec)
 		log.Printf("DEBUG: mergedConfig:\n %s\n", mc)
 	}
-	return mergedConfig
+	return mergedConfig, nil
 }
 
 // set env var and error if missing
@@ -575,32 +1020,6 @@ func setVar(envVar string, flag *string) (val string) {
 	return val
 }
 
-func writeEnvFile(secrets map[string]interface{}, filename string, removeExport bool) error {
-	var envFileContents string
-	var keys []string
-	for k := range secrets {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
-	for _, k := range keys {
-		var str string
-		if removeExport {
-			str = fmt.Sprintf("%s=\"%s\"\n", k, secrets[k])
-		} else {
-			str = fmt.Sprintf("export %s=\"%s\"\n", k, secrets[k])
-		}
-
-		envFileContents = envFileContents + str
-	}
-	contents := []byte(envFileContents)
-	err := os.WriteFile(filename, contents, 0600)
-	if err != nil {
-		return err
-	}
-	log.Printf("created/updated env file: %s", filename)
-	return nil
-}
-
 // display help
 func help() {
 	help := `
@@ -640,6 +1059,10 @@ Requires a configdir with secret maps to get started - defaults to 'vh/'
 					key: SOMETHING2_API_KEY
 		'prod.yaml':
 			secret_name: appname
+			include:
+				- name: somedep
+					params:
+						app: appname
 			key_config:
 				EXAMPLE_PASS:
 					path: secret/machine/something/prod/api
@@ -654,14 +1077,94 @@ NOTES:
 		* neither base.yaml or dev.yaml are required
 		* can have multple apps under vh/ folder
 	* files named local.yaml will not have roles/policies generated as these perms should be tied to the user
-	* qa.yaml files will generate gitlab roles which match "master" branch jwt so they can be deployed alongside master
-	* dynamic variables are allows in maps
-	  * variables between two brackets (no spaces) will be looked up from environment variables and replaced when parsing secret maps
-		* ex. {{DEV_NAME}} will be replaced with the env var for $DEV_NAME
-		* will error if variable cannot be looked up
+	* roles for prod and qa envs only match "master" branch jwts unless 'vh/roles.yaml' declares its own "protected" envs
+		* each entry maps env names or globs to "branches", "tags", "ref_protected", an "environment" and github "workflows"
+			* gitlab entries setting both branches and tags need "ref_protected: true"
+	* passing -ci-provider github generates roles for github actions oidc tokens, bound to -project-id as the "repository" claim
+		* in per-app scope a map's "ci_provider" picks the provider for that app
+	* passing -role-type kubernetes to generate-policies creates kubernetes auth roles for the "service_accounts" (name and namespace) in each env's map
+		* roles are attached to the same generated policies, -role-type jwt,kubernetes generates both kinds
+		* one <role>-<namespace> role is generated per namespace, a leftover <role> without a namespace is deleted on -apply
+	* -jwt-mount and -kubernetes-mount set the auth mounts roles are applied to and deleted from, defaulting to auth/jwt and auth/kubernetes
+		* in per-app scope a map's "jwt_mount" picks the mount for that app's jwt role
+		* each mount is checked in sys/auth to exist and be of the expected type before anything is written
+	* maps are rendered as go templates, values read from vault only get the legacy {{ENV_VAR}} substitution
+		* set "raw: true" on a key_config or full_secret_config_paths entry to pass its values through as stored
+		* {{ .Env }} is the env being processed and {{ .App }} is the app folder name
+		* {{ env "DEV_NAME" }} looks up an environment variable
+		* {{ env "DEV_NAME" | default "someone" }} falls back to a default when the variable is empty or missing
+		* {{ env "DEV_NAME" | required "DEV_NAME must be set" }} fails with the given message when the variable is empty or missing
+		* legacy variables between two brackets, ex. {{DEV_NAME}}, are still looked up from environment variables
+		* env vars which cannot be looked up are replaced with ENV_VAR_NOT_FOUND, generated policies replace that path segment with "+"
 	* can use "full_secret_config_paths" as a yaml list to simply grab all k/v pairs from secret path and add them to the secret list
 		* full_secret_config_paths are also merged together, the env requested will be resolved last, overwriting any duplicates from the base/dev files
+		* each entry can also be an object with "path", "prefix", "include"/"exclude" glob lists, a "rename" map and "case: upper|preserve"
+		* two entries from the same map setting the same key is an error unless one of them sets a higher "precedence"
+		* "recursive: true" lists the kv metadata under "path" and grabs every secret below it, deleted secrets are skipped
+			* "path_prefix: true" prefixes those keys with their path below the entry, ex. db/main becomes DB_MAIN_
+			* generated policies grant list on the metadata subtree and read on "path/*"
+	* a map's "policy" block adjusts the policy generated for its env, logging a WARN whenever a glob grants more than the paths referenced
+		* "list_metadata: true" grants list on the metadata of each read path's parent, except a mount's root
+		* "glob_full_paths: true" writes full_secret_config_paths entries as "path*"
+		* "collapse_threshold: 3" replaces 3 or more read paths sharing a parent with "parent/*"
+		* "deny" is a list of secret paths, ex. secret/app-one/prod/root/*, written as deny blocks
+		* in a combined policy each app's options only apply to the paths its own map reads
 	* can use base64 on a key_config object to retrieve value as a base64 encoded value
+	* non-secret config can be set on a key_config object with "value" (a literal) or "from_env" (an env var name) instead of path/key
+		* these keys are skipped when generating policies
+		* passing -split-configmap to create places them in a configmap named after the secret instead of the secret, if it has any
+	* a key_config object can run its value through a "transform" pipeline, steps are applied in order:
+		* base64, base64decode, hex, trim (or "trim: chars"), upper, lower
+		* "json: .path.to[0].field" extracts a field from a json secret value
+		* "template: mysql://{{ input "user" }}:{{ input "pass" }}@{{ value }}/db" composes the key's named "inputs" (each a path/key) into one value
+		* paths of all inputs are included in generated policies
+	* shared map fragments can be placed in 'vh/_shared/{name}.yaml' and pulled into a map with "include"
+		* fragments may contain "key_config" and "full_secret_config_paths"
+		* {{env}} in a fragment is bound to the env being processed, other {{placeholders}} are bound with "params"
+		* keys defined in the map itself take precedence over keys from fragments
+		* "params" can set env to pin a fragment to one env, ex. env: dev
+		* "keys" globs select which fragment keys are included, "rename" and "prefix" change the names they are included as
+	* a map can define more k8s secrets with a "secrets" list, each with a "name", optional "type", "key_config" and "full_secret_config_paths"
+		* the top level secret_name form can be used alongside the list, or left out
+		* base and env "secrets" lists are merged by name
+		* generate-env-file combines all secrets into one file, a key set by more than one secret is an error
+	* deployment targets (kube_context, namespace, kube_config and an optional apps list) can be declared per env in 'vh/targets.yaml' or in a map's "targets" list
+		* create looks up secrets once per app and writes them to each target, reporting per-target results
+		* apps without targets are written to -kube-config/-kube-context/-namespace
+	* the namespace defaults to the kube context's namespace, or "default"
+		* each target logs the context and namespace it writes to, with a WARN when falling back to "default"
+		* when no kubeconfig is set and a service account is mounted, the in-cluster config and the pod's namespace are used
+	* passing -restart-on-change to create rolls deployments, statefulsets and daemonsets using a secret when its content changes
+		* the content hash is kept in the secret's "vault-hunter/content-hash" annotation
+		* workloads are restarted by setting the "vault-hunter/restartedAt" pod template annotation
+	* annotate sets a "checksum/vault-hunter" pod template annotation on each -workload (deploy/, sts/ or ds/) with a digest of the secrets create would write
+		* the digest only changes when resolved values change, leaving the rollout to the workload
+		* each workload's digest only covers the secrets its pod template references, limited to -app and apps whose targets write to the workload's namespace
+	* exec runs the command after -- with an app's secrets in its environment, nothing is written to disk
+		* signals are forwarded to the command and its exit code is returned
+		* passing -watch restarts the command when secret values change
+			* a failed lookup is logged and the command keeps running with the current values
+	* a map's "templates" list renders go text/template files with the resolved keys, a missing key is an error
+		* generate-env-file writes each to -env-file-dir/<app>/<output>, create stores it under the "output" key of its "secret"
+	* seed writes a dotenv or .json file's values to the vault path/key each variable is read from
+		* dry run by default showing a diff without values, -write applies it using kv v2 check-and-set
+		* a path using an env var that isn't set (ENV_VAR_NOT_FOUND) is an error
+	* rotate writes a new -value (or -generate's random one) to a -path/-key and re-creates every app/env secret reading it
+		* without -env, envs with no declared targets are skipped
+	* who-uses <path>[#key] lists every app/env map reading a vault path, with the env var and generated policy/role granting it
+		* pass -output json for json instead of a table
+		* only envs an app has its own file for are searched, matching the policies and roles generate-policies creates
+	* graph prints apps -> envs -> env vars -> vault paths and ci project -> roles -> policies -> vault paths as dot, mermaid or json (-format)
+		* policies link to the paths written to them, paths read through a collapsed or globbed grant are linked to it as "covered by"
+	* generated jwt roles can be configured in 'vh/roles.yaml' - "defaults" for every role, overridden per env under "envs"
+		* token ttls, user_claim, bound_claims_type, bound_audiences, namespace_path, environment, ref_protected, bound_claims, claim_mappings, token_bound_cidrs and token_policies
+		* the file is validated against what the jwt auth method accepts before anything is generated
+	* passing -policy-scope per-app to generate-policies creates a <prefix>-<app>-<env> policy and role per app folder
+		* each role is bound to the app's "project_id", set in its map or in 'vh/projects.yaml'
+	* passing -format to generate-env-file picks the env file format: shell (default), dotenv, docker, json, yaml, properties or tfvars
+		* values are escaped as each format's parser expects, docker env files can't hold values with newlines
+		* shell, dotenv and docker values can't contain a NUL byte
+		* passing -env-file-dir - writes to stdout
 	* passing --remove-export to generate-env-file will remove any 'export ' statements in file for apps with different needs 
 
 ---
@@ -674,20 +1177,63 @@ Generate policies and roles:
 Generate and apply policies and roles:
  	vault-hunter generate-policies -project-id 60 -appname=testycat -apply
 
+Generate and apply a policy and role per app, each bound to the app's project_id:
+	vault-hunter generate-policies -policy-scope per-app -apply
+
+Generate and apply policies and roles for a github actions repository:
+	vault-hunter generate-policies -ci-provider github -project-id my-org/my-repo -appname=testycat -apply
+
+Generate and apply kubernetes auth roles for the service accounts declared in maps:
+	vault-hunter generate-policies -appname=testycat -role-type kubernetes -apply
+
+Generate and apply policies and roles to a jwt auth method mounted at auth/gitlab:
+	vault-hunter generate-policies -appname=testycat -jwt-mount gitlab -apply
+
 Generate local env file:
 	vault-hunter generate-env-file -env dev
 
+Run an app locally with its 'local' secrets:
+	vault-hunter exec -env local -app app-one -- go run ./...
+
+Show which vault keys a dev .env file would seed, then write them:
+	vault-hunter seed -env dev -from .env
+	vault-hunter seed -env dev -from .env -write
+
+Rotate a rabbitmq password and update every secret using it:
+	vault-hunter rotate -path secrets/rabbitmq/prod/app-one -key password -generate
+
+List the apps and envs reading a vault key:
+	vault-hunter who-uses secrets/yetanotherdep/dev/app-two#password -appname testycat
+
+Render a graph of who can read which secrets:
+	vault-hunter graph -appname testycat -project-id 60 | dot -Tsvg > graph.svg
+
+Print env as json to stdout:
+	vault-hunter generate-env-file -env dev -format json -env-file-dir -
+
 Delete generated policies and roles from vault:
   vault-hunter delete
 
 Verify vault-hunter can retrieve all secrets from compiled map:
 	vault-hunter create -env prod -verify
 
+Create/Update k8s secrets for 'prod' env with non-secret values in a configmap:
+	vault-hunter create -env prod -split-configmap
+
+Create/Update k8s secrets for 'prod' env using the 'prod-east' kubeconfig context:
+	vault-hunter create -env prod -kube-context prod-east
+
+Create/Update k8s secrets for 'prod' env and restart workloads whose secrets changed:
+	vault-hunter create -env prod -restart-on-change
+
+Annotate the app-one deployment with a checksum of the 'prod' secrets:
+	vault-hunter annotate -env prod -workload deploy/app-one
+
 Create/Update k8s secrets for 'prod' env with suffix:
 	vault-hunter create -env prod -secret-name-suffix=issue-53
 
 
-Commands [ create, generate-env-file, generate-policies, help ]
+Commands [ annotate, create, exec, generate-env-file, generate-policies, graph, help, rotate, seed, who-uses ]
 
 Required options:
 
@@ -2,6 +2,11 @@ package vaulthunter
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
 	"flag"
 	"io/ioutil"
 	"log"
@@ -10,6 +15,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	hlog "github.com/hashicorp/go-hclog"
 	jwt "github.com/hashicorp/vault-plugin-auth-jwt"
@@ -19,6 +25,10 @@ import (
 	"github.com/hashicorp/vault/sdk/helper/logging"
 	"github.com/hashicorp/vault/sdk/logical"
 	hashivault "github.com/hashicorp/vault/vault"
+	jose "gopkg.in/square/go-jose.v2"
+	josejwt "gopkg.in/square/go-jose.v2/jwt"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/fake"
 	v1 "k8s.io/client-go/kubernetes/typed/core/v1"
 )
@@ -29,16 +39,16 @@ func Test_withVaultServer(t *testing.T) {
 
 	// createSecret tests
 	c := AppConfig{
-		vhFolder:  "./../../mocks/vh",
-		configEnv: "dev",
+		vhFolder:      "./../../mocks/vh",
+		configEnv:     "dev",
+		kubeNamespace: "test",
 	}
 	kubeClient := fake.NewSimpleClientset()
-	secretClient := kubeClient.CoreV1().Secrets("test")
 	vclient := createTestVault(t)
 	type createSecretsArgs struct {
-		c             AppConfig
-		vclient       *vapi.Client
-		secretsClient v1.SecretInterface
+		c       AppConfig
+		vclient *vapi.Client
+		clients kubeClientFactory
 	}
 	testCreateSecrets := []struct {
 		name string
@@ -47,17 +57,647 @@ func Test_withVaultServer(t *testing.T) {
 		{
 			name: "createSecretsTest",
 			args: createSecretsArgs{
-				c:             c,
-				vclient:       vclient,
-				secretsClient: secretClient,
+				c:       c,
+				vclient: vclient,
+				clients: staticClients(kubeClient),
 			},
 		},
 	}
 	for _, tt := range testCreateSecrets {
 		t.Run(tt.name, func(t *testing.T) {
-			createSecrets(tt.args.c, tt.args.vclient, tt.args.secretsClient)
+			if err := createSecrets(tt.args.c, tt.args.vclient, tt.args.clients); err != nil {
+				t.Errorf("createSecrets() error = %v", err)
+			}
+		})
+	}
+	// values get the legacy {{VAR}} substitution but are never run as templates, raw keeps them as stored
+	t.Run("lookupSecretValueSubstitutionTest", func(t *testing.T) {
+		os.Setenv("VH_TEST_VALUE_VAR", "kitty")
+		stored := map[string]interface{}{"password": "a{{VH_TEST_VALUE_VAR}}c{{ .Nope }}", "config": "{{ if .X }}"}
+		if _, err := client.Logical().Write("secret/data/location/one/config/braces", stored); err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]string{"password": "akittyc{{ .Nope }}", "config": "{{ if .X }}"}
+		for k := range stored {
+			got, err := lookupSecretValue(client, make(secretCache), "secret/location/one/config/braces", k, false)
+			if err != nil || got != want[k] {
+				t.Errorf("lookupSecretValue() = %v, %v, want %v", got, err, want[k])
+			}
+			got, err = lookupSecretValue(client, make(secretCache), "secret/location/one/config/braces", k, true)
+			if err != nil || got != stored[k] {
+				t.Errorf("lookupSecretValue() raw = %v, %v, want %v unchanged", got, err, stored[k])
+			}
+		}
+		secrets := make(map[string]interface{})
+		if err := addFullSecret(client, FullSecretPath{Path: "secret/location/one/config/braces"}, secrets, make(map[string]FullSecretPath)); err != nil {
+			t.Fatal(err)
+		}
+		if secrets["PASSWORD"] != want["password"] {
+			t.Errorf("addFullSecret() PASSWORD = %v, want %v", secrets["PASSWORD"], want["password"])
+		}
+		secrets = make(map[string]interface{})
+		if err := addFullSecret(client, FullSecretPath{Path: "secret/location/one/config/braces", Raw: true}, secrets, make(map[string]FullSecretPath)); err != nil {
+			t.Fatal(err)
+		}
+		if secrets["PASSWORD"] != stored["password"] {
+			t.Errorf("addFullSecret() raw PASSWORD = %v, want %v unchanged", secrets["PASSWORD"], stored["password"])
+		}
+	})
+	t.Run("createSecretsSplitConfigMapTest", func(t *testing.T) {
+		os.Setenv("VH_TEST_DEV_NAME", "trex")
+		splitClient := fake.NewSimpleClientset()
+		splitConfig := AppConfig{
+			vhFolder:       "./../../mocks/vh",
+			configEnv:      "dev",
+			kubeNamespace:  "test",
+			apps:           []string{"literalapp"},
+			splitConfigMap: true,
+		}
+		if err := createSecrets(splitConfig, client, staticClients(splitClient)); err != nil {
+			t.Fatalf("createSecrets() error = %v", err)
+		}
+		secret, err := splitClient.CoreV1().Secrets("test").Get(context.TODO(), "literalapp", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("could not get created secret: %s", err)
+		}
+		wantSecret := map[string][]byte{"EXAMPLE_PASS": []byte("imadirtysecret-2")}
+		if !reflect.DeepEqual(secret.Data, wantSecret) {
+			t.Errorf("createSecrets() secret = %v, want %v", secret.Data, wantSecret)
+		}
+		configMap, err := splitClient.CoreV1().ConfigMaps("test").Get(context.TODO(), "literalapp", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("could not get created configmap: %s", err)
+		}
+		wantConfig := map[string]string{"CI_ENV": "dev", "CORP_DOMAIN": "example.com", "DEV_NAME": "trex"}
+		if !reflect.DeepEqual(configMap.Data, wantConfig) {
+			t.Errorf("createSecrets() configmap = %v, want %v", configMap.Data, wantConfig)
+		}
+	})
+	t.Run("createSecretsSplitConfigMapVaultOnlyTest", func(t *testing.T) {
+		splitClient := fake.NewSimpleClientset()
+		splitConfig := AppConfig{
+			vhFolder:       "./../../mocks/vh",
+			configEnv:      "dev",
+			kubeNamespace:  "test",
+			apps:           []string{"multiapp"},
+			splitConfigMap: true,
+		}
+		if err := createSecrets(splitConfig, client, staticClients(splitClient)); err != nil {
+			t.Fatalf("createSecrets() error = %v", err)
+		}
+		secret, err := splitClient.CoreV1().Secrets("test").Get(context.TODO(), "multiapp-db", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("could not get created secret: %s", err)
+		}
+		if len(secret.Data) != 2 {
+			t.Errorf("createSecrets() secret = %v, want DB_USER and DB_PASS", secret.Data)
+		}
+		// multiapp-db only has vault backed keys, so there is nothing to put in a configmap
+		_, err = splitClient.CoreV1().ConfigMaps("test").Get(context.TODO(), "multiapp-db", metav1.GetOptions{})
+		if !apierrors.IsNotFound(err) {
+			t.Errorf("createSecrets() created a configmap for multiapp-db, error = %v", err)
+		}
+		if _, err := splitClient.CoreV1().ConfigMaps("test").Get(context.TODO(), "multiapp", metav1.GetOptions{}); err != nil {
+			t.Errorf("could not get created configmap: %s", err)
+		}
+	})
+	t.Run("createSecretsMultipleSecretsTest", func(t *testing.T) {
+		multiClient := fake.NewSimpleClientset()
+		multiConfig := AppConfig{
+			vhFolder:      "./../../mocks/vh",
+			configEnv:     "dev",
+			kubeNamespace: "test",
+			apps:          []string{"multiapp"},
+		}
+		if err := createSecrets(multiConfig, client, staticClients(multiClient)); err != nil {
+			t.Fatalf("createSecrets() error = %v", err)
+		}
+		want := map[string]map[string][]byte{
+			"multiapp":          {"APP_MODE": []byte("base")},
+			"multiapp-db":       {"DB_USER": []byte("imadirtysecret-11"), "DB_PASS": []byte("imadirtysecret-12")},
+			"multiapp-registry": {".dockerconfigjson": []byte(`{"auths":{}}`)},
+		}
+		for name, data := range want {
+			secret, err := multiClient.CoreV1().Secrets("test").Get(context.TODO(), name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("could not get created secret %s: %s", name, err)
+			}
+			if !reflect.DeepEqual(secret.Data, data) {
+				t.Errorf("createSecrets() secret %s = %v, want %v", name, secret.Data, data)
+			}
+		}
+		registry, _ := multiClient.CoreV1().Secrets("test").Get(context.TODO(), "multiapp-registry", metav1.GetOptions{})
+		if registry.Type != "kubernetes.io/dockerconfigjson" {
+			t.Errorf("createSecrets() secret type = %v, want kubernetes.io/dockerconfigjson", registry.Type)
+		}
+		_, got, err := getSecrets(client, "./../../mocks/vh/multiapp", "dev")
+		if err != nil {
+			t.Fatalf("getSecrets() error = %v", err)
+		}
+		wantCombined := map[string]interface{}{
+			"APP_MODE":          "base",
+			"DB_USER":           "imadirtysecret-11",
+			"DB_PASS":           "imadirtysecret-12",
+			".dockerconfigjson": `{"auths":{}}`,
+		}
+		if !reflect.DeepEqual(got, wantCombined) {
+			t.Errorf("getSecrets() \ngot = \n%v, \nwant = \n%v", got, wantCombined)
+		}
+	})
+	// transform tests
+	_, err := client.Logical().Write("secret/data/location/one/config/db", map[string]interface{}{
+		"settings": map[string]interface{}{"primary": map[string]interface{}{"host": " db-1.internal "}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Run("getSecretsTestTransforms", func(t *testing.T) {
+		want := map[string]interface{}{
+			"DB_HOST":      "db-1.internal",
+			"DATABASE_URL": "mysql://imadirtysecret-3:imadirtysecret-2@db/app",
+			"API_KEY":      "SU1BRElSVFlTRUNSRVQtMQ==",
+		}
+		_, got, err := getSecrets(client, "./../../mocks/vh/transformapp", "dev")
+		if err != nil {
+			t.Errorf("getSecrets() error = %v", err)
+			return
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("getSecrets() \ngot = \n%v, \nwant = \n%v", got, want)
+		}
+	})
+
+	// full secret path option tests
+	_, err = client.Logical().Write("secret/data/location/one/config/fullsecret", map[string]interface{}{
+		"log_level":      "debug",
+		"port":           "8080",
+		"internal_token": "nope",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testFullSecrets := []struct {
+		name    string
+		folder  string
+		env     string
+		want    map[string]interface{}
+		wantErr bool
+	}{
+		{
+			name:   "getSecretsTestFullSecretOptions",
+			folder: "./../../mocks/vh/fullsecretapp",
+			env:    "dev",
+			want: map[string]interface{}{
+				"DEV_VAR1":   "imadirtysecret-11",
+				"SECOND_VAR": "imadirtysecret-12",
+				"log_level":  "debug",
+				"port":       "8080",
+			},
+		},
+		{
+			name:    "getSecretsTestFullSecretCollision",
+			folder:  "./../../mocks/vh/collisionapp",
+			env:     "dev",
+			wantErr: true,
+		},
+		{
+			name:   "getSecretsTestFullSecretPrecedence",
+			folder: "./../../mocks/vh/precedenceapp",
+			env:    "dev",
+			want: map[string]interface{}{
+				"VAR1": "imadirtysecret-11",
+				"VAR2": "imadirtysecret-12",
+				"VAR3": "imadirtysecret-13",
+			},
+		},
+	}
+	for _, tt := range testFullSecrets {
+		t.Run(tt.name, func(t *testing.T) {
+			_, got, err := getSecrets(client, tt.folder, tt.env)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("getSecrets() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getSecrets() \ngot = \n%v, \nwant = \n%v", got, tt.want)
+			}
 		})
 	}
+
+	// recursive full secret path tests - the test mounts are passthrough, so metadata entries are written alongside the data for listing
+	recursiveSecrets := map[string]map[string]interface{}{
+		"app-three/dev/api":     {"port": "9090", "timeout": "30s"},
+		"app-three/dev/db/main": {"host": "db-main.internal"},
+	}
+	for k, v := range recursiveSecrets {
+		_, err = client.Logical().Write("config/data/"+k, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = client.Logical().Write("config/metadata/"+k, map[string]interface{}{"current_version": 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a deleted kv v2 version is still listed but reads back with metadata and no data
+	_, err = client.Logical().Write("config/data/app-three/dev/old", map[string]interface{}{
+		"data":     nil,
+		"metadata": map[string]interface{}{"version": 2, "deletion_time": "2026-01-01T00:00:00Z"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Logical().Write("config/metadata/app-three/dev/old", map[string]interface{}{"current_version": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Run("getSecretsTestRecursive", func(t *testing.T) {
+		want := map[string]interface{}{
+			"API_PORT":     "9090",
+			"API_TIMEOUT":  "30s",
+			"DB_MAIN_HOST": "db-main.internal",
+			"PORT":         "8080",
+		}
+		_, got, err := getSecrets(client, "./../../mocks/vh/recursiveapp", "dev")
+		if err != nil {
+			t.Errorf("getSecrets() error = %v", err)
+			return
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("getSecrets() \ngot = \n%v, \nwant = \n%v", got, want)
+		}
+	})
+
+	t.Run("deletedSecretTest", func(t *testing.T) {
+		err := addFullSecret(client, FullSecretPath{Path: "config/app-three/dev/old"}, map[string]interface{}{}, map[string]FullSecretPath{})
+		if err == nil {
+			t.Errorf("addFullSecret() expected an error for a deleted secret")
+		}
+		_, err = lookupSecretValue(client, secretCache{}, "config/app-three/dev/old", "port", false)
+		if err == nil {
+			t.Errorf("lookupSecretValue() expected an error for a deleted secret")
+		}
+	})
+
+	// seed tests - existing keys at a path are kept, a dry run writes nothing
+	_, err = client.Logical().Write("secret/data/location/one/config/seed", map[string]interface{}{
+		"data": map[string]interface{}{"user": "old-user", "other": "keep"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Run("seedSecretsTest", func(t *testing.T) {
+		c := AppConfig{vhFolder: "./../../mocks/vh", configEnv: "dev", app: "seedapp", apps: []string{"seedapp"}}
+		values := map[string]string{"DB_USER": "app-user", "DB_PASS": "p@ss", "API_KEY": "key-1", "CORP_DOMAIN": "ignored"}
+		writes, err := seedSecrets(c, client, values)
+		if err != nil {
+			t.Fatalf("seedSecrets() error = %v", err)
+		}
+		want := "secret/location/one/config/seed (version 0)\n  + password (from DB_PASS)\n  ~ user (from DB_USER)\n" +
+			"secret/location/one/config/seed-api (new)\n  + key (from API_KEY)\n"
+		if got := formatSeedPlan(writes); got != want {
+			t.Errorf("seedSecrets() plan = %q, want %q", got, want)
+		}
+		if _, err := getSecret(modSecretPath("secret/location/one/config/seed-api"), client); err == nil {
+			t.Errorf("seedSecrets() wrote secret/location/one/config/seed-api in a dry run")
+		}
+		err = applySeed(client, writes)
+		if err != nil {
+			t.Fatalf("applySeed() error = %v", err)
+		}
+		existing, _, err := readSeedPath(client, "secret/location/one/config/seed")
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantExisting := map[string]interface{}{"user": "app-user", "password": "p@ss", "other": "keep"}
+		if !reflect.DeepEqual(existing, wantExisting) {
+			t.Errorf("seedSecrets() wrote %v, want %v", existing, wantExisting)
+		}
+		_, got, err := getSecrets(client, "./../../mocks/vh/seedapp", "dev")
+		if err != nil {
+			t.Fatalf("getSecrets() error = %v", err)
+		}
+		if got["API_KEY"] != "key-1" || got["DB_PASS"] != "p@ss" || got["DB_USER"] != "app-user" {
+			t.Errorf("getSecrets() after seed = %v", got)
+		}
+	})
+
+	// a deleted kv v2 version has no data but keeps its metadata
+	_, err = client.Logical().Write("secret/data/location/one/config/seed-deleted", map[string]interface{}{
+		"data":     nil,
+		"metadata": map[string]interface{}{"version": 3, "deletion_time": "2026-01-01T00:00:00Z"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Run("readSeedPathDeletedTest", func(t *testing.T) {
+		existing, version, err := readSeedPath(client, "secret/location/one/config/seed-deleted")
+		if err != nil {
+			t.Fatalf("readSeedPath() error = %v", err)
+		}
+		if len(existing) != 0 || version != 3 {
+			t.Errorf("readSeedPath() = %v, %v, want no data and version 3", existing, version)
+		}
+	})
+
+	// rotate tests - dev declares no targets so is skipped when rotating across envs
+	_, err = client.Logical().Write("secret/data/location/one/config/rotate", map[string]interface{}{
+		"data": map[string]interface{}{"user": "rabbit", "password": "old-pass"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Run("rotateSecretTest", func(t *testing.T) {
+		rotateClient := fake.NewSimpleClientset()
+		c := AppConfig{vhFolder: "./../../mocks/vh", apps: []string{"rotateapp"}, rotatePath: "secret/location/one/config/rotate", rotateKey: "password"}
+		got, err := rotateSecret(c, client, staticClients(rotateClient), "new-pass")
+		if err != nil {
+			t.Fatalf("rotateSecret() error = %v", err)
+		}
+		want := []rotateResult{
+			{App: "rotateapp", Env: "dev", Secrets: []string{"rotateapp"}, Status: "skipped - no targets declared, pass -env to use -kube-config/-namespace"},
+			{App: "rotateapp", Env: "prod", Secrets: []string{"rotateapp", "rotateapp-rabbit"}, Status: "updated"},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("rotateSecret() = %v, want %v", got, want)
+		}
+		existing, _, err := readSeedPath(client, "secret/location/one/config/rotate")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if existing["password"] != "new-pass" || existing["user"] != "rabbit" {
+			t.Errorf("rotateSecret() wrote %v", existing)
+		}
+		for name, key := range map[string]string{"rotateapp": "RABBIT_PASS", "rotateapp-rabbit": "RABBIT_PASSWORD"} {
+			secret, err := rotateClient.CoreV1().Secrets("rotate-prod").Get(context.TODO(), name, metav1.GetOptions{})
+			if err != nil {
+				t.Errorf("secret %s not created: %v", name, err)
+				continue
+			}
+			if string(secret.Data[key]) != "new-pass" {
+				t.Errorf("secret %s %s = %s, want new-pass", name, key, secret.Data[key])
+			}
+		}
+	})
+	t.Run("githubRoleLoginTest", func(t *testing.T) {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = client.Logical().Write("auth/jwt/config", map[string]interface{}{
+			"jwt_validation_pubkeys": []string{string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub}))},
+			"bound_issuer":           "https://token.actions.githubusercontent.com",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rconfig := &RolesConfig{Protected: []ProtectedEnv{{
+			Envs:        []string{"prod"},
+			Branches:    []string{"main"},
+			Environment: "production",
+			Workflows:   []string{"testycat/workflows/.github/workflows/deploy.yml@*"},
+		}}}
+		tmpl, err := roleFor(rconfig, "prod", "github")
+		if err != nil {
+			t.Fatal(err)
+		}
+		roleFile := filepath.Join(t.TempDir(), "testycat-prod.json")
+		if err := genRole(roleFile, []string{"vh-testycat-prod"}, "github", "testycat/test", tmpl); err != nil {
+			t.Fatal(err)
+		}
+		if err := applyRole("jwt", "vh-testycat-prod", roleFile, client); err != nil {
+			t.Fatal(err)
+		}
+		signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: key}, (&jose.SignerOptions{}).WithType("JWT"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		login := func(ref string) (*vapi.Secret, error) {
+			now := time.Now()
+			token, err := josejwt.Signed(signer).Claims(map[string]interface{}{
+				"iss":              "https://token.actions.githubusercontent.com",
+				"aud":              "https://github.com/testycat",
+				"sub":              "repo:testycat/test:environment:production",
+				"iat":              now.Unix(),
+				"nbf":              now.Add(-time.Minute).Unix(),
+				"exp":              now.Add(5 * time.Minute).Unix(),
+				"actor":            "trex",
+				"repository":       "testycat/test",
+				"ref":              ref,
+				"environment":      "production",
+				"job_workflow_ref": "testycat/workflows/.github/workflows/deploy.yml@refs/heads/main",
+			}).CompactSerialize()
+			if err != nil {
+				t.Fatal(err)
+			}
+			return client.Logical().Write("auth/jwt/login", map[string]interface{}{"role": "vh-testycat-prod", "jwt": token})
+		}
+		secret, err := login("refs/heads/main")
+		if err != nil {
+			t.Fatalf("login with a main branch jwt failed: %s", err)
+		}
+		if secret.Auth == nil || !containsString(secret.Auth.Policies, "vh-testycat-prod") {
+			t.Errorf("login with a main branch jwt got auth %v, want policy vh-testycat-prod", secret.Auth)
+		}
+		if _, err := login("refs/heads/feature"); err == nil {
+			t.Errorf("login with a feature branch jwt succeeded, want an error")
+		}
+		if err := deleteRole("jwt", "vh-testycat-prod", client); err != nil {
+			t.Error(err)
+		}
+	})
+
+	// gitlab binds ref and ref_type independently, ref_protected keeps an unprotected branch named like a tag out
+	t.Run("gitlabRoleLoginTest", func(t *testing.T) {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = client.Logical().Write("auth/jwt/config", map[string]interface{}{
+			"jwt_validation_pubkeys": []string{string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub}))},
+			"bound_issuer":           "https://gitlab.example.com",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		refProtected := true
+		rconfig := &RolesConfig{Protected: []ProtectedEnv{{
+			Envs:         []string{"prod"},
+			Branches:     []string{"main"},
+			Tags:         []string{"v*"},
+			RefProtected: &refProtected,
+		}}}
+		tmpl, err := roleFor(rconfig, "prod", "gitlab")
+		if err != nil {
+			t.Fatal(err)
+		}
+		roleFile := filepath.Join(t.TempDir(), "testycat-prod.json")
+		if err := genRole(roleFile, []string{"vh-testycat-prod"}, "gitlab", "61", tmpl); err != nil {
+			t.Fatal(err)
+		}
+		if err := applyRole("jwt", "vh-testycat-prod", roleFile, client); err != nil {
+			t.Fatal(err)
+		}
+		signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: key}, (&jose.SignerOptions{}).WithType("JWT"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		login := func(ref string, refType string, protected string) (*vapi.Secret, error) {
+			now := time.Now()
+			token, err := josejwt.Signed(signer).Claims(map[string]interface{}{
+				"iss":           "https://gitlab.example.com",
+				"sub":           "project_path:testycat/test:ref_type:" + refType + ":ref:" + ref,
+				"iat":           now.Unix(),
+				"nbf":           now.Add(-time.Minute).Unix(),
+				"exp":           now.Add(5 * time.Minute).Unix(),
+				"user_email":    "trex@example.com",
+				"project_id":    "61",
+				"ref":           ref,
+				"ref_type":      refType,
+				"ref_protected": protected,
+			}).CompactSerialize()
+			if err != nil {
+				t.Fatal(err)
+			}
+			return client.Logical().Write("auth/jwt/login", map[string]interface{}{"role": "vh-testycat-prod", "jwt": token})
+		}
+		for _, x := range []struct{ ref, refType string }{{"main", "branch"}, {"v1", "tag"}} {
+			if _, err := login(x.ref, x.refType, "true"); err != nil {
+				t.Errorf("login with a protected %s %s jwt failed: %s", x.refType, x.ref, err)
+			}
+		}
+		if _, err := login("v1", "branch", "false"); err == nil {
+			t.Errorf("login with a branch named v1 succeeded, want an error")
+		}
+		if err := deleteRole("jwt", "vh-testycat-prod", client); err != nil {
+			t.Error(err)
+		}
+	})
+
+	// roles are plain paths under the mount, so the jwt mount stands in for kubernetes auth
+	t.Run("deleteUnqualifiedKubernetesRoleTest", func(t *testing.T) {
+		_, err := client.Logical().Write("auth/jwt/role/vh-testycat-dev", map[string]interface{}{"user_claim": "sub", "bound_audiences": []string{"vault"}, "role_type": "jwt"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			if err := deleteUnqualifiedKubernetesRole("jwt", "vh-testycat-dev", client); err != nil {
+				t.Fatalf("deleteUnqualifiedKubernetesRole() error = %v", err)
+			}
+		}
+		existing, err := client.Logical().Read("auth/jwt/role/vh-testycat-dev")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if existing != nil {
+			t.Errorf("deleteUnqualifiedKubernetesRole() left role vh-testycat-dev")
+		}
+	})
+
+	t.Run("checkAuthMountTest", func(t *testing.T) {
+		mounts := []struct {
+			mount    string
+			roleType string
+			wantErr  bool
+		}{
+			{mount: "jwt", roleType: "jwt"},
+			{mount: "ci-jwt", roleType: "jwt"},
+			{mount: "gitlab", roleType: "jwt", wantErr: true},
+			{mount: "kubernetes", roleType: "kubernetes", wantErr: true},
+			{mount: "jwt", roleType: "kubernetes", wantErr: true},
+		}
+		for _, m := range mounts {
+			if err := checkAuthMount(client, m.mount, m.roleType); (err != nil) != m.wantErr {
+				t.Errorf("checkAuthMount(%s, %s) error = %v, wantErr %v", m.mount, m.roleType, err, m.wantErr)
+			}
+		}
+	})
+
+	t.Run("applyRolesJWTMountTest", func(t *testing.T) {
+		c := AppConfig{vhFolder: "./../../mocks/vh", apps: []string{"rotateapp"}, policyPrefix: "vh", policyScope: "per-app", policyLockProdClaims: true, applyConfig: true, jwtMount: "auth/ci-jwt"}
+		t.Cleanup(func() {
+			os.RemoveAll("./../../mocks/vh/generated")
+		})
+		if err := genAllRolesAndPolicies(c, client); err != nil {
+			t.Fatalf("genAllRolesAndPolicies() error = %v", err)
+		}
+		if role, err := client.Logical().Read("auth/ci-jwt/role/vh-rotateapp-dev"); err != nil || role == nil {
+			t.Errorf("role vh-rotateapp-dev wasn't written to auth/ci-jwt: %v", err)
+		}
+		if role, _ := client.Logical().Read("auth/jwt/role/vh-rotateapp-dev"); role != nil {
+			t.Errorf("role vh-rotateapp-dev was written to auth/jwt, want only auth/ci-jwt")
+		}
+		if err := deleteAllPoliciesAndRoles(c, client); err != nil {
+			t.Errorf("deleteAllPoliciesAndRoles() error = %v", err)
+		}
+		if role, _ := client.Logical().Read("auth/ci-jwt/role/vh-rotateapp-dev"); role != nil {
+			t.Errorf("role vh-rotateapp-dev wasn't deleted from auth/ci-jwt")
+		}
+
+		c.jwtMount = "gitlab"
+		if err := genAllRolesAndPolicies(c, client); err == nil {
+			t.Errorf("genAllRolesAndPolicies() with a missing jwt mount succeeded, want an error")
+		}
+		if policy, _ := client.Sys().GetPolicy("vh-rotateapp-dev"); policy != "" {
+			t.Errorf("policy vh-rotateapp-dev was written before the missing mount was caught")
+		}
+	})
+
+	t.Run("policyOptionsAccessTest", func(t *testing.T) {
+		filename := "./../../mocks/options-policy.hcl"
+		t.Cleanup(func() {
+			os.RemoveAll(filename)
+		})
+		if err := genPolicy(filename, "./../../mocks/vh", []string{"optionsapp"}, "dev"); err != nil {
+			t.Fatal(err)
+		}
+		if err := applyPolicy("vh-optionsapp-dev", filename, client); err != nil {
+			t.Fatal(err)
+		}
+		// the test mounts are passthrough, so metadata entries are written alongside the data for listing
+		for _, p := range []string{"optionsapp/dev/db", "optionsapp/dev/root/admin", "optionsapp/prod/db"} {
+			if _, err := client.Logical().Write("secret/data/"+p, map[string]interface{}{"key": "value"}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := client.Logical().Write("secret/metadata/"+p, map[string]interface{}{"current_version": 1}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		token, err := client.Auth().Token().Create(&vapi.TokenCreateRequest{Policies: []string{"vh-optionsapp-dev"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		scoped, err := client.Clone()
+		if err != nil {
+			t.Fatal(err)
+		}
+		scoped.SetToken(token.Auth.ClientToken)
+
+		if _, err := scoped.Logical().Read("secret/data/optionsapp/dev/db"); err != nil {
+			t.Errorf("reading a referenced path failed: %s", err)
+		}
+		if list, err := scoped.Logical().List("secret/metadata/optionsapp/dev"); err != nil || list == nil {
+			t.Errorf("listing the referenced paths' metadata failed: %v", err)
+		}
+		if _, err := scoped.Logical().Read("secret/data/optionsapp/dev/root/admin"); err == nil {
+			t.Errorf("reading a denied path succeeded, want an error")
+		}
+		if _, err := scoped.Logical().Read("secret/data/optionsapp/prod/db"); err == nil {
+			t.Errorf("reading an unreferenced path succeeded, want an error")
+		}
+		if err := deletePolicy("vh-optionsapp-dev", client); err != nil {
+			t.Error(err)
+		}
+	})
+
 	// getSecrets tests
 	type getSecretArgs struct {
 		client *vapi.Client
@@ -287,6 +927,7 @@ func Test_withVaultServer(t *testing.T) {
 		})
 	}
 	type applyRoleargs struct {
+		mount    string
 		roleName string
 		filename string
 		client   *vapi.Client
@@ -299,6 +940,17 @@ func Test_withVaultServer(t *testing.T) {
 		{
 			name: "applyRoleTest",
 			args: applyRoleargs{
+				mount:    "jwt",
+				roleName: "test-role",
+				filename: "./../../mocks/generated/roles/testapp-dev.json",
+				client:   client,
+			},
+			wantErr: false,
+		},
+		{
+			name: "applyRoleOtherMountTest",
+			args: applyRoleargs{
+				mount:    "ci-jwt",
 				roleName: "test-role",
 				filename: "./../../mocks/generated/roles/testapp-dev.json",
 				client:   client,
@@ -308,10 +960,10 @@ func Test_withVaultServer(t *testing.T) {
 	}
 	for _, tt := range testApplyRoles {
 		t.Run(tt.name, func(t *testing.T) {
-			if err := applyRole(tt.args.roleName, tt.args.filename, tt.args.client); (err != nil) != tt.wantErr {
+			if err := applyRole(tt.args.mount, tt.args.roleName, tt.args.filename, tt.args.client); (err != nil) != tt.wantErr {
 				t.Errorf("applyRole() error = %v, wantErr %v", err, tt.wantErr)
 			}
-			if err := deleteRole(tt.args.roleName, tt.args.client); (err != nil) != tt.wantErr {
+			if err := deleteRole(tt.args.mount, tt.args.roleName, tt.args.client); (err != nil) != tt.wantErr {
 				t.Errorf("deleteRole() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
@@ -428,6 +1080,13 @@ func createTestVault(t *testing.T) *vapi.Client {
 	if err != nil {
 		t.Error(err)
 	}
+	// roles can be applied to auth methods mounted at other paths
+	err = client.Sys().EnableAuthWithOptions("ci-jwt", &vapi.EnableAuthOptions{
+		Type: "jwt",
+	})
+	if err != nil {
+		t.Error(err)
+	}
 	for k, v := range testData {
 		var value string
 		if strings.Contains(v.Key, "ENV_VAR_REPLACEMENT") {
@@ -529,7 +1188,7 @@ func Test_mergeConfig(t *testing.T) {
 				env: "test"},
 			wantData: SecretConfig{
 				SecretName:            "someotherapp",
-				FullSecretConfigPaths: []string{"secret/machine/config/app-two-client-dev"},
+				FullSecretConfigPaths: FullSecretConfigPaths{{Path: "secret/machine/config/app-two-client-dev"}},
 				KeyConfig: KeyConfig{
 					"EXAMPLE_PASS": KeyDef{
 						Path: "secret/machine/anotherdep/prod",
@@ -607,12 +1266,14 @@ func Test_createAppEnvConfigSecret(t *testing.T) {
 	type args struct {
 		secretsClient v1.SecretInterface
 		secretName    string
+		secretType    string
 		env           map[string]interface{}
 	}
 	tests := []struct {
-		name    string
-		args    args
-		wantErr bool
+		name        string
+		args        args
+		wantChanged bool
+		wantErr     bool
 	}{
 		{
 			name: "createK8sSecretTest",
@@ -636,45 +1297,45 @@ func Test_createAppEnvConfigSecret(t *testing.T) {
 					"TESTKEY2": "someotherpassword2",
 				},
 			},
-			wantErr: false,
+			wantChanged: true,
+			wantErr:     false,
 		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if err := createAppEnvConfigSecret(tt.args.secretsClient, tt.args.secretName, tt.args.env); (err != nil) != tt.wantErr {
-				t.Errorf("createAppEnvConfigSecret() error = %v, wantErr %v", err, tt.wantErr)
-			}
-		})
-	}
-}
-
-func Test_getKubeClient(t *testing.T) {
-	type args struct {
-		kconfig   string
-		namespace string
-	}
-	tests := []struct {
-		name string
-		args args
-		// want    v1.SecretInterface
-		wantErr bool
-	}{
 		{
-			name: "getKubeClientTest",
+			name: "createK8sSecretUnchangedTest",
 			args: args{
-				kconfig:   "./../../mocks/kubeconfig",
-				namespace: "default",
+				secretsClient: secretClient,
+				secretName:    "testyboi",
+				env: map[string]interface{}{
+					"TESTKEY":  "somepassword2",
+					"TESTKEY2": "someotherpassword2",
+				},
+			},
+			wantChanged: false,
+			wantErr:     false,
+		},
+		{
+			name: "createK8sSecretTypedTest",
+			args: args{
+				secretsClient: secretClient,
+				secretName:    "registry",
+				secretType:    "kubernetes.io/dockerconfigjson",
+				env: map[string]interface{}{
+					".dockerconfigjson": `{"auths":{}}`,
+				},
 			},
 			wantErr: false,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := getKubeClient(tt.args.kconfig, tt.args.namespace)
+			changed, err := createAppEnvConfigSecret(tt.args.secretsClient, tt.args.secretName, tt.args.secretType, tt.args.env)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("getKubeClient() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("createAppEnvConfigSecret() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
+			if changed != tt.wantChanged {
+				t.Errorf("createAppEnvConfigSecret() changed = %v, want %v", changed, tt.wantChanged)
+			}
 		})
 	}
 }
@@ -763,7 +1424,7 @@ EXAMPLE_2="anotherthing"` + "\n",
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if err := writeEnvFile(tt.args.secrets, tt.args.filename, tt.args.removeExport); (err != nil) != tt.wantErr {
+			if err := writeEnvFile(tt.args.secrets, tt.args.filename, "shell", tt.args.removeExport); (err != nil) != tt.wantErr {
 				t.Errorf("writeEnvFile() error = %v, wantErr %v", err, tt.wantErr)
 			}
 			f1, err1 := ioutil.ReadFile(tt.args.filename)
@@ -824,3 +1485,155 @@ func Test_replaceMapVars(t *testing.T) {
 		})
 	}
 }
+
+func Test_parseVhFolder(t *testing.T) {
+	tests := []struct {
+		name        string
+		vhFolder    string
+		wantApp     string
+		skippedApps []string
+		wantErr     bool
+	}{
+		{
+			name:        "parseVhFolderSkipsSharedTest",
+			vhFolder:    "./../../mocks/vh",
+			wantApp:     "includeapp",
+			skippedApps: []string{sharedFolder, "generated"},
+			wantErr:     false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseVhFolder(AppConfig{vhFolder: tt.vhFolder})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseVhFolder() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !containsString(got.apps, tt.wantApp) {
+				t.Errorf("parseVhFolder() apps = %v, missing %v", got.apps, tt.wantApp)
+			}
+			for _, x := range tt.skippedApps {
+				if containsString(got.apps, x) {
+					t.Errorf("parseVhFolder() apps = %v, should not contain %v", got.apps, x)
+				}
+			}
+		})
+	}
+}
+
+func Test_resolveKeyDef(t *testing.T) {
+	literal := "example.com"
+	type args struct {
+		name string
+		v    KeyDef
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    string
+		wantErr bool
+	}{
+		{name: "resolveKeyDefValueTest", args: args{name: "CORP_DOMAIN", v: KeyDef{Value: &literal, Transform: Transforms{{Name: "upper"}}}}, want: "EXAMPLE.COM", wantErr: false},
+		{name: "resolveKeyDefFromEnvTest", args: args{name: "DEV_NAME", v: KeyDef{FromEnv: "VH_TEST_DEV_NAME"}}, want: "trex", wantErr: false},
+		{name: "resolveKeyDefFromEnvMissingTest", args: args{name: "DEV_NAME", v: KeyDef{FromEnv: "VH_TEST_MISSING"}}, wantErr: true},
+		{name: "resolveKeyDefValueAndPathTest", args: args{name: "CORP_DOMAIN", v: KeyDef{Value: &literal, Path: "secret/one", Key: "domain"}}, wantErr: true},
+		{name: "resolveKeyDefEmptyTest", args: args{name: "EMPTY", v: KeyDef{}}, wantErr: true},
+		{
+			name: "resolveKeyDefCachedInputsTest",
+			args: args{name: "URL", v: KeyDef{
+				Inputs: map[string]KeyDef{
+					"user": {Path: "secret/cached/db", Key: "user"},
+					"pass": {Path: "secret/cached/db", Key: "pass"},
+				},
+				Transform: Transforms{{Name: "template", Arg: `{{ input "user" }}:{{ input "pass" }}`}},
+			}},
+			want:    "bob:hunter2",
+			wantErr: false,
+		},
+		{
+			name: "resolveKeyDefLiteralInputsTest",
+			args: args{name: "URL", v: KeyDef{
+				Inputs:    map[string]KeyDef{"host": {Value: &literal}, "user": {FromEnv: "VH_TEST_DEV_NAME"}},
+				Transform: Transforms{{Name: "template", Arg: `https://{{ input "user" }}@{{ input "host" }}`}},
+			}},
+			want:    "https://trex@example.com",
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv("VH_TEST_DEV_NAME", "trex")
+			// inputs read from secret/cached/db are served by the cache, a nil client fails any actual read
+			cache := secretCache{"secret/data/cached/db": &vapi.Secret{Data: map[string]interface{}{"data": map[string]interface{}{"user": "bob", "pass": "hunter2"}}}}
+			got, err := resolveKeyDef(nil, cache, tt.args.name, tt.args.v)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("resolveKeyDef() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("resolveKeyDef() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_splitNonSecrets(t *testing.T) {
+	literal := "dev"
+	keys := KeyConfig{
+		"CI_ENV":       {Value: &literal},
+		"DEV_NAME":     {FromEnv: "DEV_NAME"},
+		"EXAMPLE_PASS": {Path: "secret/one", Key: "pass"},
+		"COMPOSED":     {Value: &literal, Inputs: map[string]KeyDef{"pass": {Path: "secret/one", Key: "pass"}}},
+	}
+	secrets := map[string]interface{}{"CI_ENV": "dev", "DEV_NAME": "trex", "EXAMPLE_PASS": "hunter2", "COMPOSED": "dev-hunter2"}
+	wantSecrets := map[string]interface{}{"EXAMPLE_PASS": "hunter2", "COMPOSED": "dev-hunter2"}
+	wantConfig := map[string]interface{}{"CI_ENV": "dev", "DEV_NAME": "trex"}
+	gotSecrets, gotConfig := splitNonSecrets(keys, secrets)
+	if !reflect.DeepEqual(gotSecrets, wantSecrets) {
+		t.Errorf("splitNonSecrets() secrets = %v, want %v", gotSecrets, wantSecrets)
+	}
+	if !reflect.DeepEqual(gotConfig, wantConfig) {
+		t.Errorf("splitNonSecrets() config = %v, want %v", gotConfig, wantConfig)
+	}
+}
+
+func Test_createAppEnvConfigMap(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset()
+	configMapClient := kubeClient.CoreV1().ConfigMaps("test")
+	type args struct {
+		configMapsClient v1.ConfigMapInterface
+		configMapName    string
+		env              map[string]interface{}
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+	}{
+		{
+			name: "createK8sConfigMapTest",
+			args: args{
+				configMapsClient: configMapClient,
+				configMapName:    "testyboi",
+				env:              map[string]interface{}{"CI_ENV": "dev"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "createK8sConfigMapDuplicateTest",
+			args: args{
+				configMapsClient: configMapClient,
+				configMapName:    "testyboi",
+				env:              map[string]interface{}{"CI_ENV": "prod"},
+			},
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := createAppEnvConfigMap(tt.args.configMapsClient, tt.args.configMapName, tt.args.env); (err != nil) != tt.wantErr {
+				t.Errorf("createAppEnvConfigMap() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package vaulthunter
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+)
+
+// splits a who-uses query of the form path#key, the key is optional
+func parseWhoUsesQuery(q string) (string, string, error) {
+	p, key := q, ""
+	if i := strings.LastIndex(q, "#"); i >= 0 {
+		p, key = q[:i], q[i+1:]
+	}
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return "", "", fmt.Errorf("missing vault path, ex. vault-hunter who-uses secrets/yetanotherdep/dev/app-two#password")
+	}
+	return p, key, nil
+}
+
+// every app/env map reading the path and key, along with the generated policy and role granting it
+// local envs get no policy or role
+func whoUses(c AppConfig, p string, key string) ([]secretReference, error) {
+	refs, err := findReferences(c, p, key)
+	if err != nil {
+		return nil, err
+	}
+	for i := range refs {
+		if refs[i].Env == "local" || (c.policyScope != "per-app" && c.appName == "") {
+			continue
+		}
+		refs[i].Policy = scopedPolicyName(c, refs[i].App, refs[i].Env)
+		refs[i].Role = refs[i].Policy
+	}
+	return refs, nil
+}
+
+// renders who-uses results as a table or json
+func formatWhoUses(refs []secretReference, output string) (string, error) {
+	switch output {
+	case "", "table":
+		var b strings.Builder
+		w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "APP\tENV\tSECRET\tVAR\tKEY\tPOLICY/ROLE")
+		for _, x := range refs {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", x.App, x.Env, x.Secret, x.Var, orDash(x.Key), orDash(x.Policy))
+		}
+		w.Flush()
+		return b.String(), nil
+	case "json":
+		if refs == nil {
+			refs = []secretReference{}
+		}
+		j, err := json.MarshalIndent(refs, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(j) + "\n", nil
+	default:
+		return "", fmt.Errorf("unknown output: %s - must be table or json", output)
+	}
+}
+
+// "-" for empty table cells
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
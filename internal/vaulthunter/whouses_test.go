@@ -0,0 +1,142 @@
+package vaulthunter
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func Test_parseWhoUsesQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		q       string
+		want    string
+		want1   string
+		wantErr bool
+	}{
+		{name: "parseWhoUsesQueryPathTest", q: "secrets/yetanotherdep/dev/app-two", want: "secrets/yetanotherdep/dev/app-two"},
+		{name: "parseWhoUsesQueryKeyTest", q: "/secrets/yetanotherdep/dev/app-two/#password", want: "secrets/yetanotherdep/dev/app-two", want1: "password"},
+		{name: "parseWhoUsesQueryEmptyTest", q: "#password", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, got1, err := parseWhoUsesQuery(tt.q)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseWhoUsesQuery() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want || got1 != tt.want1 {
+				t.Errorf("parseWhoUsesQuery() = %v, %v, want %v, %v", got, got1, tt.want, tt.want1)
+			}
+		})
+	}
+}
+
+func Test_whoUses(t *testing.T) {
+	c := AppConfig{vhFolder: "./../../mocks/vh", apps: []string{"rotateapp"}, policyPrefix: "vh", appName: "testycat"}
+	got, err := whoUses(c, "secret/location/one/config/rotate", "")
+	if err != nil {
+		t.Fatalf("whoUses() error = %v", err)
+	}
+	p := "secret/location/one/config/rotate"
+	want := []secretReference{
+		{App: "rotateapp", Env: "dev", Secret: "rotateapp", Var: "RABBIT_PASS", Path: p, Key: "password", Policy: "vh-testycat-dev", Role: "vh-testycat-dev"},
+		{App: "rotateapp", Env: "dev", Secret: "rotateapp", Var: "RABBIT_USER", Path: p, Key: "user", Policy: "vh-testycat-dev", Role: "vh-testycat-dev"},
+		{App: "rotateapp", Env: "prod", Secret: "rotateapp", Var: "RABBIT_PASS", Path: p, Key: "password", Policy: "vh-testycat-prod", Role: "vh-testycat-prod"},
+		{App: "rotateapp", Env: "prod", Secret: "rotateapp", Var: "RABBIT_USER", Path: p, Key: "user", Policy: "vh-testycat-prod", Role: "vh-testycat-prod"},
+		{App: "rotateapp", Env: "prod", Secret: "rotateapp-rabbit", Var: "RABBIT_*", Path: p, Policy: "vh-testycat-prod", Role: "vh-testycat-prod"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("whoUses() = %v, want %v", got, want)
+	}
+}
+
+func Test_formatWhoUses(t *testing.T) {
+	refs := []secretReference{
+		{App: "app-two", Env: "dev", Secret: "app-two", Var: "DB_PASS", Path: "secrets/db", Key: "password", Policy: "vh-testycat-dev", Role: "vh-testycat-dev"},
+		{App: "app-two", Env: "local", Secret: "app-two", Var: "DB_*", Path: "secrets/db"},
+	}
+	tests := []struct {
+		name    string
+		refs    []secretReference
+		output  string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "formatWhoUsesTableTest",
+			refs:   refs,
+			output: "table",
+			want: "APP      ENV    SECRET   VAR      KEY       POLICY/ROLE\n" +
+				"app-two  dev    app-two  DB_PASS  password  vh-testycat-dev\n" +
+				"app-two  local  app-two  DB_*     -         -\n",
+		},
+		{
+			name:   "formatWhoUsesJSONTest",
+			refs:   refs[:1],
+			output: "json",
+			want: `[
+  {
+    "app": "app-two",
+    "env": "dev",
+    "secret": "app-two",
+    "var": "DB_PASS",
+    "path": "secrets/db",
+    "key": "password",
+    "policy": "vh-testycat-dev",
+    "role": "vh-testycat-dev"
+  }
+]
+`,
+		},
+		{name: "formatWhoUsesJSONEmptyTest", output: "json", want: "[]\n"},
+		{name: "formatWhoUsesUnknownTest", output: "xml", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := formatWhoUses(tt.refs, tt.output)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("formatWhoUses() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("formatWhoUses() = \n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_popPositionalArg(t *testing.T) {
+	defer func(args []string) {
+		os.Args = args
+	}(os.Args)
+	tests := []struct {
+		name     string
+		args     []string
+		want     string
+		wantArgs []string
+	}{
+		{
+			name:     "popPositionalArgTest",
+			args:     []string{"vault-hunter", "who-uses", "secrets/db#password", "-output", "json"},
+			want:     "secrets/db#password",
+			wantArgs: []string{"vault-hunter", "who-uses", "-output", "json"},
+		},
+		{
+			name:     "popPositionalArgFlagTest",
+			args:     []string{"vault-hunter", "who-uses", "-output", "json", "secrets/db"},
+			wantArgs: []string{"vault-hunter", "who-uses", "-output", "json", "secrets/db"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Args = append([]string{}, tt.args...)
+			if got := popPositionalArg(); got != tt.want {
+				t.Errorf("popPositionalArg() = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(os.Args, tt.wantArgs) {
+				t.Errorf("popPositionalArg() left %v, want %v", os.Args, tt.wantArgs)
+			}
+		})
+	}
+}
@@ -0,0 +1,4 @@
+path "secret/data/location/one/config/app-two-client-dev" {
+  capabilities = ["read"]
+}
+
@@ -0,0 +1,32 @@
+path "secret/data/optionsapp/dev/*" {
+  capabilities = ["read"]
+}
+
+path "secret/data/shared/dev/token" {
+  capabilities = ["read"]
+}
+
+path "config/data/optionsapp/dev*" {
+  capabilities = ["read"]
+}
+
+path "secret/metadata/optionsapp/dev" {
+  capabilities = ["list"]
+}
+
+path "secret/metadata/shared/dev" {
+  capabilities = ["list"]
+}
+
+path "config/metadata/optionsapp" {
+  capabilities = ["list"]
+}
+
+path "secret/data/optionsapp/dev/root/*" {
+  capabilities = ["deny"]
+}
+
+path "secret/metadata/optionsapp/dev/root/*" {
+  capabilities = ["deny"]
+}
+
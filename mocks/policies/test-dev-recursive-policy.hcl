@@ -0,0 +1,12 @@
+path "config/metadata/app-three/dev/*" {
+  capabilities = ["list"]
+}
+
+path "config/data/app-three/dev/*" {
+  capabilities = ["read"]
+}
+
+path "secret/data/location/one/config/fullsecret" {
+  capabilities = ["read"]
+}
+
@@ -0,0 +1,16 @@
+path "secret/data/location/one/conduit/api" {
+  capabilities = ["read"]
+}
+
+path "secret/data/location/one/anotherdep/prod" {
+  capabilities = ["read"]
+}
+
+path "secret/data/location/one/somedep/admin" {
+  capabilities = ["read"]
+}
+
+path "secret/data/location/one/config/db" {
+  capabilities = ["read"]
+}
+